@@ -0,0 +1,186 @@
+package olbermann
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// An AlertEvent describes an alert rule firing.
+type AlertEvent struct {
+	Rule      string    // The rule that fired, such as "Faults iter > 100 for 3"
+	Set       string    // The metric struct's type
+	Metric    string    // The FullName of the metric series that broke the rule
+	Report    string    // The report that broke it, such as "w99"
+	Value     float64   // The report's latest value
+	Intervals int       // For how many intervals in a row the condition has held
+	Time      time.Time // The end of the interval in which the rule fired
+}
+
+// value formats the event's value as the metric's values are formatted in
+// msv, its set's latest values, if there are any.
+func (ev *AlertEvent) value(msv *metricSetValue) string {
+	if msv != nil {
+		for i := range msv.metrics {
+			mv := &msv.metrics[i]
+			if mv.fullName() != ev.Metric {
+				continue
+			}
+			for j := range mv.reports {
+				if mv.reports[j].name == ev.Report {
+					return mv.format.human(mv.reports[j].rt, ev.Value)
+				}
+			}
+		}
+	}
+	return strconv.FormatFloat(ev.Value, 'f', 2, 64)
+}
+
+// An AlertCount says how many times an alert rule has fired.
+type AlertCount struct {
+	Rule  string
+	Fired int
+}
+
+// An alertRule fires when its condition has held for a number of
+// intervals in a row, for any one series of the metric.  It fires again
+// only once the condition has stopped holding.
+type alertRule struct {
+	rule      string
+	cond      Condition
+	intervals int
+	// the metric struct type the rule is restricted to, "" for any
+	set      string
+	callback func(AlertEvent)
+	streaks  map[string]int
+	fired    int
+}
+
+// reset forgets the rule's streaks and how often it fired.
+func (ar *alertRule) reset() {
+	ar.streaks = make(map[string]int)
+	ar.fired = 0
+}
+
+// newAlertRule parses a rule of the form "<condition> [for <n>]".  The
+// metric may be left out of the condition if it is given separately.
+func newAlertRule(rule string, metric string) (ar *alertRule, err error) {
+	ar = &alertRule{intervals: 1, streaks: make(map[string]int)}
+	cond := rule
+	if i := strings.LastIndex(rule, " for "); i >= 0 {
+		cond = rule[:i]
+		if ar.intervals, err = strconv.Atoi(strings.TrimSpace(rule[i+len(" for "):])); err != nil || ar.intervals < 1 {
+			err = errors.New("alert " + strconv.Quote(rule) + " must hold for a positive number of intervals")
+			return
+		}
+	}
+	if ar.cond, err = parseCondition(cond); err != nil {
+		return
+	}
+	if ar.cond.Metric == "" {
+		if metric == "" {
+			err = errors.New("alert " + strconv.Quote(rule) + " must name a metric and a report")
+			return
+		}
+		ar.cond.Metric = metric
+	}
+	ar.rule = ar.cond.String()
+	if ar.intervals > 1 {
+		ar.rule += " for " + strconv.Itoa(ar.intervals)
+	}
+	return
+}
+
+// check updates the rule with a new snapshot, returning the events for
+// series that have just broken it.
+func (ar *alertRule) check(s *Snapshot) (events []AlertEvent) {
+	for i := range s.Metrics {
+		m := &s.Metrics[i]
+		if ar.set != "" && m.Set != ar.set || !ar.cond.matches(m) {
+			continue
+		}
+		for j := range m.Reports {
+			if m.Reports[j].Name != ar.cond.Report {
+				continue
+			}
+			key := m.Set + " " + m.FullName()
+			if holds, err := ar.cond.holds(m.Reports[j].Value, m.Unit); err != nil || !holds {
+				ar.streaks[key] = 0
+				continue
+			}
+			ar.streaks[key]++
+			if ar.streaks[key] == ar.intervals {
+				ar.fired++
+				events = append(events, AlertEvent{Rule: ar.rule, Set: m.Set, Metric: m.FullName(), Report: m.Reports[j].Name, Value: m.Reports[j].Value, Intervals: ar.streaks[key], Time: s.Time})
+			}
+		}
+	}
+	return
+}
+
+// newAlertRules parses a metric's "alert" tag, a list of rules separated
+// by semicolons, such as `alert:"w99>50ms for 3; c99>20ms"`.
+func newAlertRules(field reflect.StructField, metric *metricType, errs *fieldErrors) (rules []*alertRule) {
+	tag := field.Tag.Get("alert")
+	if tag == "" {
+		return
+	}
+	for _, rule := range strings.Split(tag, ";") {
+		ar, err := newAlertRule(strings.TrimSpace(rule), metric.name)
+		if err != nil {
+			errs.add(field, "alert", err.Error())
+			continue
+		}
+		if ar.cond.Metric != metric.name {
+			errs.add(field, "alert", "alert "+strconv.Quote(rule)+" must be about this metric")
+			continue
+		}
+		known := false
+		for i := range metric.reportNames {
+			known = known || metric.reportNames[i] == ar.cond.Report
+		}
+		if !known {
+			errs.add(field, "alert", "metric has no report "+strconv.Quote(ar.cond.Report))
+			continue
+		}
+		if _, err := ar.cond.thresholdIn(metric.format.unit); err != nil {
+			errs.add(field, "alert", err.Error())
+			continue
+		}
+		rules = append(rules, ar)
+	}
+	return
+}
+
+// Alert adds an alert rule to the Reporter.  A rule is a condition (see
+// ParseCondition) optionally followed by the number of intervals in a row
+// it must hold for, such as "Faults iter > 100 for 3" or
+// "Latency w99 > 50ms".  Rules can also be declared with a metric's
+// "alert" tag, leaving out the metric, as in `alert:"w99>50ms"`.
+//
+// When a rule fires, the callback (if not nil) and the Reporter's OnAlert
+// are called, DstatStylers print a highlighted line, and the firing is
+// counted in the final report printed by Close.
+func (r *Reporter) Alert(rule string, callback func(AlertEvent)) error {
+	ar, err := newAlertRule(rule, "")
+	if err != nil {
+		return err
+	}
+	ar.callback = callback
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.alerts = append(r.alerts, ar)
+	return nil
+}
+
+// AlertCounts returns how many times each alert rule has fired.
+func (r *Reporter) AlertCounts() (counts []AlertCount) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	for i := range r.alerts {
+		counts = append(counts, AlertCount{Rule: r.alerts[i].rule, Fired: r.alerts[i].fired})
+	}
+	return
+}
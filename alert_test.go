@@ -0,0 +1,147 @@
+package olbermann
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestParseCondition(t *testing.T) {
+	for _, c := range []struct {
+		s        string
+		expected Condition
+	}{
+		{"Latency c99 < 20ms", Condition{"Latency", "c99", "<", 20, "ms"}},
+		{"Transactions cum >= 5K/s", Condition{"Transactions", "cum", ">=", 5000, ""}},
+		{"Disk.Written iter>1.5MB", Condition{"Disk.Written", "iter", ">", 1.5e6, "B"}},
+		{"Faults total <= 0", Condition{"Faults", "total", "<=", 0, ""}},
+	} {
+		cond, err := ParseCondition(c.s)
+		if err != nil {
+			t.Errorf("unexpected error parsing %q: %v", c.s, err)
+		} else if cond != c.expected {
+			t.Errorf("expected %q to parse as %+v, got %+v", c.s, c.expected, cond)
+		}
+	}
+	for _, s := range []string{"Latency c99", "c99 < 20ms", "Latency c99 < fast", "a b c < 1"} {
+		if _, err := ParseCondition(s); err == nil {
+			t.Errorf("expected an error parsing %q", s)
+		}
+	}
+	cond, _ := ParseCondition("Latency w99 > 50ms")
+	for _, c := range []struct {
+		value    float64
+		unit     string
+		expected bool
+	}{
+		{60, "ms", true},
+		{40, "ms", false},
+		{60000, "us", true},
+		{0.04, "s", false},
+		{60, "", false},
+	} {
+		if holds, _ := cond.holds(c.value, c.unit); holds != c.expected {
+			t.Errorf("expected %v%s > 50ms to be %v", c.value, c.unit, c.expected)
+		}
+	}
+	if _, err := cond.holds(60, "B"); err == nil {
+		t.Error("expected an error comparing ms with B")
+	}
+}
+
+type alertMetric struct {
+	Op      string  `label:"op"`
+	Faults  int     `type:"counter" report:"total" alert:"total>2 for 2"`
+	Latency float64 `type:"latency" report:"w99" unit:"us"`
+}
+
+func TestAlerts(t *testing.T) {
+	var buf bytes.Buffer
+	r := &Reporter{}
+	var onAlert, callback []AlertEvent
+	r.OnAlert = func(ev AlertEvent) { onAlert = append(onAlert, ev) }
+	if err := r.Alert("Latency w99 > 1ms", func(ev AlertEvent) { callback = append(callback, ev) }); err != nil {
+		t.Fatal(err)
+	}
+	s := &DstatStyler{LinesBetweenHeaders: -1, Logger: log.New(&buf, "", 0)}
+	tr := startTestRun(t, r, alertMetric{}, s)
+	// Started for another metric set too, it still prints one summary.
+	if err := r.Start(csvMetric{}, s); err != nil {
+		t.Fatal(err)
+	}
+	for _, latency := range []float64{500, 2000, 1500, 100} {
+		tr.interval(alertMetric{"get", 1, latency})
+	}
+	r.Close()
+
+	if len(callback) != 1 || callback[0].Metric != "Latency{op=get}" || callback[0].Value != 2000 || callback[0].Rule != "Latency w99 > 1ms" {
+		t.Errorf("expected one latency alert, got %+v", callback)
+	}
+	if len(onAlert) != 2 || onAlert[1].Rule != "Faults total > 2 for 2" || onAlert[1].Value != 4 || onAlert[1].Intervals != 2 {
+		t.Errorf("expected a latency and a faults alert, got %+v", onAlert)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	expected := []string{
+		"!!! ALERT Latency w99 > 1ms: Latency{op=get} is 2.00ms",
+		"!!! ALERT Faults total > 2 for 2: Faults{op=get} is 4",
+		"--- alerts ---",
+		"Latency w99 > 1ms: fired 1 times",
+		"Faults total > 2 for 2: fired 1 times",
+	}
+	var alertLines []string
+	for _, line := range lines {
+		if strings.HasPrefix(line, "!!!") || !strings.Contains(line, "|") {
+			alertLines = append(alertLines, line)
+		}
+	}
+	if strings.Join(alertLines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected alert lines\n%s\ngot\n%s", strings.Join(expected, "\n"), buf.String())
+	}
+}
+
+func TestAlertsAfterClose(t *testing.T) {
+	r := &Reporter{}
+	var fired []AlertEvent
+	if err := r.Alert("Latency w99 > 1ms", func(ev AlertEvent) { fired = append(fired, ev) }); err != nil {
+		t.Fatal(err)
+	}
+	for run := 1; run <= 2; run++ {
+		startTestRun(t, r, alertMetric{}, &CsvStyler{Writer: &bytes.Buffer{}}).interval(alertMetric{"get", 3, 2000})
+		r.Close()
+		if len(fired) != run {
+			t.Fatalf("expected the rule to fire in run %d, got %v", run, fired)
+		}
+		// Until the set is started again, only the added rule is left.
+		if counts := r.AlertCounts(); len(counts) != 1 || counts[0].Fired != 0 {
+			t.Errorf("expected only the added rule, reset, after Close, got %+v", counts)
+		}
+	}
+}
+
+func TestAlertValidation(t *testing.T) {
+	type badAlerts struct {
+		A int     `type:"counter" report:"iter" alert:"cum>1"`
+		B int     `type:"counter" report:"iter" alert:"iter>1ms"`
+		C float64 `type:"latency" report:"w99" unit:"ms" alert:"w99>1s for 0; w99>2s"`
+		D int     `type:"counter" report:"iter" alert:"A iter>1"`
+	}
+	verr, ok := Validate(badAlerts{}).(*ValidationError)
+	if !ok {
+		t.Fatal("expected a *ValidationError")
+	}
+	expected := []string{
+		`A alert:"cum>1": metric has no report "cum"`,
+		`B alert:"iter>1ms": threshold of B iter > 1ms has unit ms but the metric has none`,
+		`C alert:"w99>1s for 0; w99>2s": alert "w99>1s for 0" must hold for a positive number of intervals`,
+		`D alert:"A iter>1": alert "A iter>1" must be about this metric`,
+	}
+	if len(verr.Errors) != len(expected) {
+		t.Fatalf("expected %d errors, got %v", len(expected), verr)
+	}
+	for i := range expected {
+		if s := verr.Errors[i].Error(); s != expected[i] {
+			t.Errorf("expected error %q, got %q", expected[i], s)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package olbermann
+
+import (
+	"fmt"
+	"strings"
+)
+
+// An AssertionResult is the outcome of checking one assertion against one
+// metric series, at Close.
+type AssertionResult struct {
+	Assertion string  // The assertion, such as "Latency c99 < 20ms"
+	Metric    string  // The FullName of the series checked, or "" if none was found
+	Value     float64 // The report's final value
+	Passed    bool
+	Err       string // Why the assertion couldn't be checked, if it couldn't
+}
+
+func (ar *AssertionResult) String() string {
+	status := "PASS"
+	if !ar.Passed {
+		status = "FAIL"
+	}
+	if ar.Err != "" {
+		return fmt.Sprintf("%s %s: %s", status, ar.Assertion, ar.Err)
+	}
+	return fmt.Sprintf("%s %s: %s is %g", status, ar.Assertion, ar.Metric, ar.Value)
+}
+
+// An AssertionError is returned by Benchmark.Stop when any assertion fails.
+type AssertionError struct {
+	Results []AssertionResult // Every assertion's result, passed or failed
+}
+
+// Failed returns the results of the assertions that failed.
+func (e *AssertionError) Failed() (failed []AssertionResult) {
+	for i := range e.Results {
+		if !e.Results[i].Passed {
+			failed = append(failed, e.Results[i])
+		}
+	}
+	return
+}
+
+func (e *AssertionError) Error() string {
+	failed := e.Failed()
+	msgs := make([]string, len(failed))
+	for i := range failed {
+		msgs[i] = failed[i].String()
+	}
+	return fmt.Sprintf("olbermann: %d of %d assertions failed: %s", len(failed), len(e.Results), strings.Join(msgs, "; "))
+}
+
+// Assert adds conditions (see ParseCondition) that the final values must
+// satisfy when the Reporter is closed, such as "Latency c99 < 20ms" or
+// "Transactions cum > 5000/s".  A condition on a labeled metric's Name must
+// hold for every one of its series.
+//
+// Only cumulative reports (cum, total, and latency reports starting with
+// c) can be asserted on, since the final values are taken partway through
+// an interval, which windowed and iter reports would cover only a sliver
+// of, often nothing at all.
+//
+// Close checks the assertions, and AssertionResults returns how they came
+// out, so a benchmark can fail a test or exit with an error:
+//
+// 	if err := r.Assert("Latency c99 < 20ms", "Transactions cum > 5000/s"); err != nil {
+// 		log.Fatal(err)
+// 	}
+// 	...
+// 	r.Close()
+// 	for _, result := range r.AssertionResults() {
+// 		if !result.Passed {
+// 			log.Fatal(result.String())
+// 		}
+// 	}
+func (r *Reporter) Assert(conditions ...string) error {
+	parsed := make([]Condition, len(conditions))
+	for i := range conditions {
+		var err error
+		if parsed[i], err = ParseCondition(conditions[i]); err != nil {
+			return err
+		}
+		if !isCumulativeReport(parsed[i].Report) {
+			return fmt.Errorf("olbermann: can't assert %q: %s only covers part of the last interval at Close, use a cumulative report such as cum, total or c99", conditions[i], parsed[i].Report)
+		}
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.assertions = append(r.assertions, parsed...)
+	return nil
+}
+
+// AssertionResults returns the results of the assertions checked by the
+// last Close.
+func (r *Reporter) AssertionResults() []AssertionResult {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.results
+}
+
+// isCumulativeReport reports whether a report covers the whole run.
+func isCumulativeReport(name string) bool {
+	switch {
+	case name == "cum" || name == "total":
+		return true
+	case len(name) > 1 && name[0] == 'c':
+		return name[1] >= '0' && name[1] <= '9' || name[1] == '.'
+	}
+	return false
+}
+
+// assertionError returns an *AssertionError if any of results failed.
+func assertionError(results []AssertionResult) error {
+	for i := range results {
+		if !results[i].Passed {
+			return &AssertionError{Results: results}
+		}
+	}
+	return nil
+}
+
+func checkAssertions(conditions []Condition, s *Snapshot) (results []AssertionResult) {
+	for i := range conditions {
+		cond := &conditions[i]
+		found := false
+		for j := range s.Metrics {
+			m := &s.Metrics[j]
+			if !cond.matches(m) {
+				continue
+			}
+			for k := range m.Reports {
+				if m.Reports[k].Name != cond.Report {
+					continue
+				}
+				found = true
+				result := AssertionResult{Assertion: cond.String(), Metric: m.FullName(), Value: m.Reports[k].Value}
+				holds, err := cond.holds(result.Value, m.Unit)
+				if err != nil {
+					result.Err = err.Error()
+				}
+				result.Passed = holds
+				results = append(results, result)
+			}
+		}
+		if !found {
+			results = append(results, AssertionResult{Assertion: cond.String(), Err: "no such metric and report"})
+		}
+	}
+	return
+}
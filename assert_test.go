@@ -0,0 +1,94 @@
+package olbermann
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"strings"
+	"testing"
+)
+
+type assertMetric struct {
+	Op           string  `label:"op"`
+	Transactions int     `type:"counter" report:"total"`
+	Latency      float64 `type:"latency" report:"c99" unit:"ms"`
+}
+
+func TestAssertions(t *testing.T) {
+	var buf bytes.Buffer
+	r := &Reporter{}
+	if err := r.Assert("Latency c99 < 20ms", "Transactions total >= 3", "Latency{op=get} c99 < 0.01s", "Missing c99 < 1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Assert("Latency c99"); err == nil {
+		t.Error("expected an error for an assertion without a comparison")
+	}
+	tr := startTestRun(t, r, assertMetric{}, &DstatStyler{LinesBetweenHeaders: -1, Logger: log.New(&buf, "", 0)})
+	tr.interval(assertMetric{"get", 3, 5})
+	// Values fed after the last interval must count too.
+	tr.mst.update(assertMetric{"put", 1, 30})
+	r.Close()
+	err := assertionError(r.AssertionResults())
+	aerr, ok := err.(*AssertionError)
+	if !ok {
+		t.Fatal("expected an *AssertionError, got", err)
+	}
+	expected := []string{
+		"PASS Latency c99 < 20ms: Latency{op=get} is 5",
+		"FAIL Latency c99 < 20ms: Latency{op=put} is 30",
+		"PASS Transactions total >= 3: Transactions{op=get} is 3",
+		"FAIL Transactions total >= 3: Transactions{op=put} is 1",
+		"PASS Latency{op=get} c99 < 0.01s: Latency{op=get} is 5",
+		"FAIL Missing c99 < 1: no such metric and report",
+	}
+	if len(aerr.Results) != len(expected) {
+		t.Fatalf("expected %d results, got %v", len(expected), aerr.Results)
+	}
+	for i := range expected {
+		if s := aerr.Results[i].String(); s != expected[i] {
+			t.Errorf("expected result %q, got %q", expected[i], s)
+		}
+	}
+	if len(aerr.Failed()) != 3 || !strings.HasPrefix(err.Error(), "olbermann: 3 of 6 assertions failed: FAIL Latency c99 < 20ms") {
+		t.Error("unexpected error", err)
+	}
+	if !strings.Contains(buf.String(), "--- assertions ---\n"+strings.Join(expected, "\n")) {
+		t.Errorf("expected the final report to list the results, got\n%s", buf.String())
+	}
+}
+
+func TestAssertionsPass(t *testing.T) {
+	r := &Reporter{}
+	if err := r.Assert("Transactions total > 0"); err != nil {
+		t.Fatal(err)
+	}
+	tr := startTestRun(t, r, assertMetric{}, &DstatStyler{Logger: log.New(ioutil.Discard, "", 0)})
+	tr.mst.update(assertMetric{"get", 1, 5})
+	r.Close()
+	if err := assertionError(r.AssertionResults()); err != nil {
+		t.Error("expected assertions to pass, got", err)
+	}
+}
+
+func TestAssertionsCumulative(t *testing.T) {
+	r := &Reporter{}
+	for _, cond := range []string{"Latency w99 < 20ms", "Transactions iter > 100", "Transactions ewma1 > 100"} {
+		if err := r.Assert(cond); err == nil {
+			t.Errorf("expected an error asserting %q", cond)
+		}
+	}
+	if err := r.Assert("Latency c99 < 20ms", "Transactions total > 100"); err != nil {
+		t.Fatal(err)
+	}
+	tr := startTestRun(t, r, assertMetric{}, &DstatStyler{Logger: log.New(ioutil.Discard, "", 0)})
+	for i := 0; i < 1000; i++ {
+		tr.mst.update(assertMetric{"get", 1, 500})
+	}
+	tr.interval()
+	// Nothing comes in during the final interval.
+	r.Close()
+	results := r.AssertionResults()
+	if len(results) != 2 || results[0].Passed || results[0].Value != 500 || !results[1].Passed {
+		t.Errorf("expected the whole run to be checked, got %v", results)
+	}
+}
@@ -0,0 +1,101 @@
+package olbermann
+
+import (
+	"time"
+)
+
+// A Benchmark feeds a Reporter during a testing.B benchmark, and when
+// stopped reports chosen values with b.ReportMetric, so they show up in
+// "go test -bench" output and in benchstat comparisons.
+//
+// Rates are measured from when the Benchmark is created, so create it
+// after any setup.
+//
+// Usage:
+// 	func BenchmarkQuery(b *testing.B) {
+// 		bm, err := olbermann.NewBenchmark(b, QueryMetric{})
+// 		if err != nil {
+// 			b.Fatal(err)
+// 		}
+// 		bm.ReportMetric("Latency", "c99", "p99-ns")
+// 		bm.ReportMetric("Ops", "cum", "ops/s")
+// 		for i := 0; i < b.N; i++ {
+// 			start := time.Now()
+// 			query()
+// 			bm.C <- QueryMetric{Ops: 1, Latency: float64(time.Since(start))}
+// 		}
+// 		if err := bm.Stop(); err != nil {
+// 			b.Error(err)
+// 		}
+// 	}
+type Benchmark struct {
+	C        chan<- interface{} // Metric values to report
+	Reporter *Reporter          // The Reporter, for adding assertions or alerts
+	b        BenchmarkB
+	c        chan interface{}
+	fed      chan bool
+	metrics  []benchmarkMetric
+}
+
+// BenchmarkB is the part of a *testing.B that a Benchmark uses.  Taking it
+// rather than a *testing.B keeps the testing package, and its flags, out of
+// programs that use olbermann.
+type BenchmarkB interface {
+	ReportMetric(n float64, unit string)
+	Errorf(format string, args ...interface{})
+}
+
+type benchmarkMetric struct {
+	metric string
+	report string
+	unit   string
+}
+
+// nullStyler is a Styler that prints nothing.
+type nullStyler struct{}
+
+func (s nullStyler) period() time.Duration                              { return time.Second }
+func (s nullStyler) linesBetweenHeaders() int                           { return -1 }
+func (s nullStyler) printHeader(msv *metricSetValue)                    {}
+func (s nullStyler) printValues(curTime time.Time, msv *metricSetValue) {}
+
+// NewBenchmark starts a Reporter for values like sample, fed from the
+// Benchmark's C.  b is usually a *testing.B.
+func NewBenchmark(b BenchmarkB, sample interface{}) (bm *Benchmark, err error) {
+	c := make(chan interface{}, 1024)
+	r := &Reporter{C: c}
+	if err = r.Start(sample, nullStyler{}); err != nil {
+		return
+	}
+	bm = &Benchmark{C: c, Reporter: r, b: b, c: c, fed: make(chan bool)}
+	go func() {
+		r.Feed()
+		close(bm.fed)
+	}()
+	return
+}
+
+// ReportMetric asks for a metric's report to be passed to b.ReportMetric
+// with the given unit when the Benchmark stops.  The metric is looked up
+// by Name or FullName, as in Snapshot.Value.
+func (bm *Benchmark) ReportMetric(metric string, report string, unit string) {
+	bm.metrics = append(bm.metrics, benchmarkMetric{metric, report, unit})
+}
+
+// Stop closes C, closes the Reporter, and reports the requested metrics
+// from its final values.  It returns an *AssertionError if any of the
+// Reporter's assertions failed.
+func (bm *Benchmark) Stop() error {
+	close(bm.c)
+	<-bm.fed
+	bm.Reporter.Close()
+	s := bm.Reporter.Snapshot()
+	for _, m := range bm.metrics {
+		if v, ok := s.Value(m.metric, m.report); ok {
+			bm.b.ReportMetric(v, m.unit)
+		} else {
+			bm.b.Errorf("olbermann: no report %s for metric %s", m.report, m.metric)
+		}
+	}
+	return assertionError(bm.Reporter.AssertionResults())
+}
@@ -0,0 +1,36 @@
+package olbermann
+
+import (
+	"testing"
+)
+
+type benchMetric struct {
+	Ops     int     `type:"counter" report:"total,cum"`
+	Latency float64 `type:"latency" report:"c99"`
+}
+
+func TestBenchmark(t *testing.T) {
+	var stopErr error
+	result := testing.Benchmark(func(b *testing.B) {
+		bm, err := NewBenchmark(b, benchMetric{})
+		if err != nil {
+			b.Fatal(err)
+		}
+		bm.ReportMetric("Ops", "total", "ops")
+		bm.ReportMetric("Latency", "c99", "p99-ns")
+		bm.Reporter.Assert("Ops total > 0")
+		for i := 0; i < b.N; i++ {
+			bm.C <- benchMetric{Ops: 1, Latency: 42}
+		}
+		stopErr = bm.Stop()
+	})
+	if stopErr != nil {
+		t.Error("expected assertions to pass, got", stopErr)
+	}
+	if result.Extra["ops"] != float64(result.N) {
+		t.Error("expected ops to be reported as", result.N, "got", result.Extra["ops"])
+	}
+	if result.Extra["p99-ns"] != 42 {
+		t.Error("expected p99-ns to be reported as 42, got", result.Extra["p99-ns"])
+	}
+}
@@ -0,0 +1,183 @@
+package olbermann
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Chart dimensions, in SVG user units.
+const (
+	chartWidth       = 800
+	chartPanelHeight = 180
+	chartMarginLeft  = 70
+	chartMarginRight = 20
+	chartTitleHeight = 24
+	chartAxisHeight  = 24
+)
+
+// chartColors are the colors of a panel's series, in turn.
+var chartColors = []string{"#1f77b4", "#ff7f0e", "#2ca02c", "#d62728", "#9467bd", "#8c564b", "#e377c2", "#7f7f7f"}
+
+// A chartPanel is one metric series, with a column for each report.
+type chartPanel struct {
+	title   string
+	reports []string
+	columns []int
+}
+
+// panels groups the Run's columns by metric series, in order.
+func (run *Run) panels() (panels []chartPanel) {
+	for j := range run.Columns {
+		name, labels, report := splitColumn(run.Columns[j])
+		title := name
+		if labels != "" {
+			title += "{" + labels + "}"
+		}
+		if len(panels) == 0 || panels[len(panels)-1].title != title {
+			panels = append(panels, chartPanel{title: title})
+		}
+		p := &panels[len(panels)-1]
+		p.reports = append(p.reports, report)
+		p.columns = append(p.columns, j)
+	}
+	return
+}
+
+// formatAxis formats an axis label briefly.
+func formatAxis(val float64) string {
+	return strconv.FormatFloat(val, 'g', 4, 64)
+}
+
+// WriteSVG draws the Run as an SVG image of line charts over time, one
+// panel per metric series, with a line for each of its reports.
+func (run *Run) WriteSVG(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	panels := run.panels()
+	height := chartPanelHeight * len(panels)
+	if height == 0 {
+		height = chartPanelHeight
+	}
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="11">`+"\n",
+		chartWidth, height, chartWidth, height)
+	fmt.Fprintf(bw, `<rect width="%d" height="%d" fill="white"/>`+"\n", chartWidth, height)
+	if len(run.Rows) == 0 {
+		fmt.Fprintf(bw, `<text x="%d" y="%d" text-anchor="middle">no data</text>`+"\n", chartWidth/2, height/2)
+	}
+	for i := range panels {
+		if len(run.Rows) > 0 {
+			run.writePanel(bw, &panels[i], i*chartPanelHeight)
+		}
+	}
+	bw.WriteString("</svg>\n")
+	return bw.Flush()
+}
+
+// writePanel draws one panel, top units down the image.
+func (run *Run) writePanel(w *bufio.Writer, p *chartPanel, top int) {
+	left, right := float64(chartMarginLeft), float64(chartWidth-chartMarginRight)
+	plotTop := float64(top + chartTitleHeight)
+	plotBottom := float64(top + chartPanelHeight - chartAxisHeight)
+
+	// Scale from zero, unless values go below it.
+	lo, hi := 0.0, math.Inf(-1)
+	for i := range run.Rows {
+		for _, j := range p.columns {
+			if v := run.Rows[i][j]; !math.IsNaN(v) && !math.IsInf(v, 0) {
+				lo, hi = math.Min(lo, v), math.Max(hi, v)
+			}
+		}
+	}
+	if math.IsInf(hi, -1) || hi <= lo {
+		hi = lo + 1
+	}
+	start := run.Times[0]
+	span := run.Times[len(run.Times)-1].Sub(start)
+	x := func(t time.Time) float64 {
+		if span <= 0 {
+			return left
+		}
+		return left + (right-left)*float64(t.Sub(start))/float64(span)
+	}
+	y := func(v float64) float64 {
+		return plotBottom - (plotBottom-plotTop)*(v-lo)/(hi-lo)
+	}
+
+	fmt.Fprintf(w, `<text x="%g" y="%g" font-weight="bold">%s</text>`+"\n", left, plotTop-8, html.EscapeString(p.title))
+	legendX := right
+	for k := len(p.reports) - 1; k >= 0; k-- {
+		fmt.Fprintf(w, `<text x="%g" y="%g" text-anchor="end" fill="%s">%s</text>`+"\n",
+			legendX, plotTop-8, chartColors[k%len(chartColors)], html.EscapeString(p.reports[k]))
+		legendX -= float64(7*len(p.reports[k]) + 12)
+	}
+	fmt.Fprintf(w, `<rect x="%g" y="%g" width="%g" height="%g" fill="none" stroke="#ccc"/>`+"\n", left, plotTop, right-left, plotBottom-plotTop)
+	for _, v := range []float64{lo, (lo + hi) / 2, hi} {
+		fmt.Fprintf(w, `<line x1="%g" y1="%.1f" x2="%g" y2="%.1f" stroke="#eee"/>`+"\n", left, y(v), right, y(v))
+		fmt.Fprintf(w, `<text x="%g" y="%.1f" text-anchor="end" dominant-baseline="middle">%s</text>`+"\n", left-6, y(v), html.EscapeString(run.formatValue(p.columns[0], v, formatAxis)))
+	}
+	fmt.Fprintf(w, `<text x="%g" y="%g">%s</text>`+"\n", left, plotBottom+14, start.Format("15:04:05"))
+	fmt.Fprintf(w, `<text x="%g" y="%g" text-anchor="end">+%s</text>`+"\n", right, plotBottom+14, span)
+
+	for k, j := range p.columns {
+		// Unreported values break the line.
+		var points []string
+		flush := func() {
+			if len(points) > 0 {
+				fmt.Fprintf(w, `<polyline fill="none" stroke="%s" stroke-width="1.5" points="`, chartColors[k%len(chartColors)])
+				for n := range points {
+					if n > 0 {
+						w.WriteString(" ")
+					}
+					w.WriteString(points[n])
+				}
+				w.WriteString(`"/>` + "\n")
+			}
+			points = points[:0]
+		}
+		for i := range run.Rows {
+			v := run.Rows[i][j]
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				flush()
+				continue
+			}
+			points = append(points, fmt.Sprintf("%.1f,%.1f", x(run.Times[i]), y(v)))
+		}
+		flush()
+	}
+}
+
+// ChartStyler is a Styler that collects every interval's values and, when
+// the Reporter is closed, draws them as an SVG chart to Writer, as
+// Run.WriteSVG does.
+type ChartStyler struct {
+	Period time.Duration // How often to collect values
+	Writer io.Writer     // A writer to draw the chart to
+	Err    error         // Any error from drawing the chart
+	run    Run
+}
+
+func (s *ChartStyler) period() time.Duration {
+	return s.Period
+}
+
+func (s *ChartStyler) linesBetweenHeaders() int {
+	return -1
+}
+
+func (s *ChartStyler) err() error {
+	return s.Err
+}
+
+func (s *ChartStyler) printHeader(msv *metricSetValue) {}
+
+func (s *ChartStyler) printValues(curTime time.Time, msv *metricSetValue) {
+	s.run.appendValues(msv)
+}
+
+func (s *ChartStyler) printFinal(report *finalReport) {
+	s.Err = s.run.WriteSVG(s.Writer)
+}
@@ -0,0 +1,100 @@
+package olbermann
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestWriteSVG(t *testing.T) {
+	run, err := ReadCsv(strings.NewReader(testCsv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := run.WriteSVG(&buf); err != nil {
+		t.Fatal(err)
+	}
+	svg := buf.String()
+	dec := xml.NewDecoder(strings.NewReader(svg))
+	for {
+		if _, err := dec.Token(); err != nil {
+			if err != io.EOF {
+				t.Fatal("expected well-formed SVG:", err)
+			}
+			break
+		}
+	}
+	if n := strings.Count(svg, "<rect x="); n != 3 {
+		t.Error("expected a panel for each of 3 metric series, got", n)
+	}
+	if !strings.Contains(svg, "Latency{op=get}") || !strings.Contains(svg, ">w99<") {
+		t.Error("expected panel titles and legends")
+	}
+	if n := strings.Count(svg, "<polyline"); n != 3 {
+		t.Error("expected a line for each column, got", n)
+	}
+}
+
+func TestChartStyler(t *testing.T) {
+	var buf bytes.Buffer
+	s := &ChartStyler{Writer: &buf}
+	r := &Reporter{}
+	tr := startTestRun(t, r, recordedMetric{}, s)
+	// Started for another metric set too, it still draws one chart.
+	if err := r.Start(csvMetric{}, s); err != nil {
+		t.Fatal(err)
+	}
+	tr.interval(recordedMetric{Op: "get", Ops: 1, Latency: 1})
+	for i := 2; i <= 3; i++ {
+		tr.interval(recordedMetric{Op: "get", Ops: int64(i), Latency: 1}, recordedMetric{Op: "put", Ops: 1, Latency: 2})
+	}
+	r.Close()
+	if s.Err != nil {
+		t.Fatal(s.Err)
+	}
+	if len(s.run.Rows) != 3 || len(s.run.Columns) != 9 {
+		t.Fatalf("expected 3 rows of 9 columns, got %d rows of %v", len(s.run.Rows), s.run.Columns)
+	}
+	if v := s.run.Rows[2][s.run.indexes["olbermann.recordedMetric Ops{op=get} total"]]; v != 6 {
+		t.Error("expected a total of 6 gets, got", v)
+	}
+	if n := strings.Count(buf.String(), "<svg "); n != 1 {
+		t.Error("expected one chart, got", n)
+	}
+	if n := strings.Count(buf.String(), "<rect x="); n != 6 {
+		t.Error("expected a panel for each of 6 metric series, got", n)
+	}
+}
+
+func TestChartStylerSameNames(t *testing.T) {
+	type readMetric struct {
+		Ops int64 `type:"counter" report:"total"`
+	}
+	type writeMetric struct {
+		Ops int64 `type:"counter" report:"total"`
+	}
+	s := &ChartStyler{Writer: &bytes.Buffer{}}
+	r := &Reporter{}
+	tr := startTestRun(t, r, readMetric{}, s)
+	tr.interval(readMetric{Ops: 1})
+	if err := r.Start(writeMetric{}, s); err != nil {
+		t.Fatal(err)
+	}
+	writes, _ := r.metricSetFor(writeMetric{})
+	writes.update(writeMetric{Ops: 100})
+	tr.interval(readMetric{Ops: 2})
+	r.Close()
+	expected := []string{"olbermann.readMetric Ops total", "olbermann.writeMetric Ops total"}
+	if len(s.run.Columns) != 2 || s.run.Columns[0] != expected[0] || s.run.Columns[1] != expected[1] {
+		t.Fatalf("expected columns %q, got %q", expected, s.run.Columns)
+	}
+	if reads := s.run.Column(expected[0]); len(reads) != 2 || reads[0] != 1 || reads[1] != 3 {
+		t.Error("expected 1 then 3 reads, got", reads)
+	}
+	if writes := s.run.Column(expected[1]); len(writes) != 1 || writes[0] != 100 {
+		t.Error("expected 100 writes, got", writes)
+	}
+}
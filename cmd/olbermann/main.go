@@ -0,0 +1,178 @@
+// Command olbermann looks at runs reported by olbermann's CsvStyler after
+// the fact.
+//
+// Usage:
+//
+// 	olbermann summary [-from d] [-to d] file...
+// 	olbermann dstat [-from d] [-to d] file...
+// 	olbermann json [-from d] [-to d] file...
+// 	olbermann svg [-from d] [-to d] file...
+// 	olbermann compare [-from d] [-to d] [-alpha a] old new
+//
+// summary prints the min, mean, max and standard deviation of every column
+// of each file.  dstat prints each file again as DstatStyler would have.
+// json converts each file to JSON, one object per line.  svg draws each
+// file as line charts over time, one per metric series, to the file's name
+// with ".svg" added.
+//
+// compare prints how the mean of every column two runs have in common
+// changed from the old run to the new, with a 95% confidence interval and
+// the p-value of a Mann-Whitney U test over their rows.  Changes that
+// aren't significant at level alpha are shown as "~", as benchstat does.
+//
+// Files may be CsvStyler's output or olbermann's JSON, compressed with gzip
+// or not, and "-" reads standard input.  -from and -to choose the part of
+// each run to look at, measured from its first row, such as "-from 5m" to
+// leave out warmup.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/leifwalsh/olbermann"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: olbermann summary|dstat|json|svg [-from duration] [-to duration] file...")
+	fmt.Fprintln(os.Stderr, "       olbermann compare [-from duration] [-to duration] [-alpha a] old new")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	var command func(name string, run *olbermann.Run) error
+	switch os.Args[1] {
+	case "summary":
+		command = summary
+	case "dstat":
+		command = dstat
+	case "json":
+		command = toJSON
+	case "svg":
+		command = svg
+	case "compare":
+	default:
+		usage()
+	}
+	flags := flag.NewFlagSet(os.Args[1], flag.ExitOnError)
+	from := flags.Duration("from", 0, "leave out rows before this long after the first")
+	to := flags.Duration("to", 0, "leave out rows after this long after the first, if positive")
+	alpha := flags.Float64("alpha", 0.05, "the significance level for compare")
+	flags.Parse(os.Args[2:])
+	if command == nil {
+		if flags.NArg() != 2 {
+			usage()
+		}
+		if err := compare(flags.Arg(0), flags.Arg(1), *from, *to, *alpha); err != nil {
+			fmt.Fprintln(os.Stderr, "olbermann:", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if flags.NArg() == 0 {
+		usage()
+	}
+	failed := false
+	for _, name := range flags.Args() {
+		run, err := readRun(name)
+		if err == nil {
+			err = command(name, run.Window(*from, *to))
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "olbermann: %s: %v\n", name, err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func readRun(name string) (run *olbermann.Run, err error) {
+	if name == "-" {
+		return olbermann.ReadRun(os.Stdin)
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	return olbermann.ReadRun(f)
+}
+
+func summary(name string, run *olbermann.Run) error {
+	fmt.Printf("%s: %d rows", name, len(run.Rows))
+	if len(run.Rows) > 0 {
+		fmt.Printf(", %s to %s", run.Times[0].Format(time.RFC3339), run.Times[len(run.Times)-1].Format(time.RFC3339))
+	}
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "column\tn\tmin\tmean\tmax\tstddev\t")
+	for _, s := range run.Summarize() {
+		fmt.Fprintf(w, "%s\t%d\t%.6g\t%.6g\t%.6g\t%.6g\t\n", s.Column, s.N, s.Min, s.Mean, s.Max, s.Stddev)
+	}
+	err := w.Flush()
+	fmt.Println()
+	return err
+}
+
+func dstat(name string, run *olbermann.Run) error {
+	run.Render(&olbermann.DstatStyler{
+		LinesBetweenHeaders: 24,
+		Logger:              log.New(os.Stdout, "", 0),
+		TimeFormat:          "2006/01/02 15:04:05",
+	})
+	return nil
+}
+
+func toJSON(name string, run *olbermann.Run) error {
+	return json.NewEncoder(os.Stdout).Encode(run)
+}
+
+func svg(name string, run *olbermann.Run) error {
+	if name == "-" {
+		return run.WriteSVG(os.Stdout)
+	}
+	f, err := os.Create(name + ".svg")
+	if err != nil {
+		return err
+	}
+	if err = run.WriteSVG(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func compare(oldName string, newName string, from time.Duration, to time.Duration, alpha float64) error {
+	old, err := readRun(oldName)
+	if err != nil {
+		return fmt.Errorf("%s: %v", oldName, err)
+	}
+	new, err := readRun(newName)
+	if err != nil {
+		return fmt.Errorf("%s: %v", newName, err)
+	}
+	comparisons := olbermann.Compare(old.Window(from, to), new.Window(from, to))
+	if len(comparisons) == 0 {
+		return fmt.Errorf("%s and %s have no columns in common", oldName, newName)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(w, "column\told\tnew\tdelta\t95%% interval\tp\t\n")
+	for _, c := range comparisons {
+		delta := "~"
+		if c.Significant(alpha) {
+			delta = fmt.Sprintf("%+.2f%%", 100*c.Change())
+		}
+		fmt.Fprintf(w, "%s\t%.6g ±%.2g\t%.6g ±%.2g\t%s\t[%.4g, %.4g]\t%.3f\t\n",
+			c.Column, c.Old.Mean, c.Old.Stddev, c.New.Mean, c.New.Stddev, delta, c.Low, c.High, c.P)
+	}
+	return w.Flush()
+}
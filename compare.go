@@ -0,0 +1,143 @@
+package olbermann
+
+import (
+	"math"
+	"sort"
+)
+
+// A Comparison describes how one column changed between two Runs.
+type Comparison struct {
+	Column string
+	Old    ColumnSummary
+	New    ColumnSummary
+	Delta  float64 // New.Mean - Old.Mean
+	Low    float64 // The low end of Delta's 95% confidence interval
+	High   float64 // The high end of Delta's 95% confidence interval
+	P      float64 // The p-value of a Mann-Whitney U test that the values come from the same distribution
+}
+
+// Change is Delta relative to the old mean, e.g. 0.05 for 5% more.
+func (c *Comparison) Change() float64 {
+	return c.Delta / c.Old.Mean
+}
+
+// Significant is whether the difference is significant at level alpha,
+// such as 0.05.
+func (c *Comparison) Significant(alpha float64) bool {
+	return c.P < alpha
+}
+
+// Compare compares every column the two Runs have in common, in the order
+// of the old Run.  Each row is taken as one sample, so pick steady-state
+// Windows of both Runs first, and compare per-interval reports such as
+// "Transactions iter" or "Latency w99" rather than cumulative ones.
+//
+// The confidence interval is Welch's, and assumes the interval values are
+// roughly normal and independent.  The Mann-Whitney U test makes no
+// assumption about their distribution.
+func Compare(old *Run, new *Run) (comparisons []Comparison) {
+	inNew := make(map[string]bool)
+	for _, col := range new.Columns {
+		inNew[col] = true
+	}
+	for _, col := range old.Columns {
+		if !inNew[col] {
+			continue
+		}
+		oldValues, newValues := old.Column(col), new.Column(col)
+		c := Comparison{Column: col, Old: summarize(col, oldValues), New: summarize(col, newValues)}
+		c.Delta = c.New.Mean - c.Old.Mean
+		c.Low, c.High = welchInterval(&c.Old, &c.New)
+		c.P = mannWhitney(oldValues, newValues)
+		comparisons = append(comparisons, c)
+	}
+	return
+}
+
+// tQuantiles are the 97.5th percentiles of Student's t distribution with
+// 1 to 30 degrees of freedom.
+var tQuantiles = []float64{
+	12.706, 4.303, 3.182, 2.776, 2.571, 2.447, 2.365, 2.306, 2.262, 2.228,
+	2.201, 2.179, 2.160, 2.145, 2.131, 2.120, 2.110, 2.101, 2.093, 2.086,
+	2.080, 2.074, 2.069, 2.064, 2.060, 2.056, 2.052, 2.048, 2.045, 2.042,
+}
+
+// tQuantile is the 97.5th percentile of Student's t distribution with df
+// degrees of freedom, rounded down.
+func tQuantile(df float64) float64 {
+	if df < 1 {
+		return math.NaN()
+	}
+	if df <= float64(len(tQuantiles)) {
+		return tQuantiles[int(df)-1]
+	}
+	// Cornish-Fisher expansion around the normal distribution.
+	const z = 1.959964
+	return z + (z*z*z+z)/(4*df) + (5*z*z*z*z*z+16*z*z*z+3*z)/(96*df*df)
+}
+
+// welchInterval is the 95% confidence interval for the difference between
+// two means, by Welch's t-test.
+func welchInterval(old *ColumnSummary, new *ColumnSummary) (low float64, high float64) {
+	if old.N < 2 || new.N < 2 {
+		return math.NaN(), math.NaN()
+	}
+	vo := old.Stddev * old.Stddev / float64(old.N)
+	vn := new.Stddev * new.Stddev / float64(new.N)
+	se := math.Sqrt(vo + vn)
+	delta := new.Mean - old.Mean
+	if se == 0 {
+		return delta, delta
+	}
+	df := (vo + vn) * (vo + vn) / (vo*vo/float64(old.N-1) + vn*vn/float64(new.N-1))
+	margin := tQuantile(df) * se
+	return delta - margin, delta + margin
+}
+
+// mannWhitney is the two-sided p-value of a Mann-Whitney U test that a and
+// b come from the same distribution, by the normal approximation with
+// corrections for ties and continuity.
+func mannWhitney(a []float64, b []float64) float64 {
+	na, nb := float64(len(a)), float64(len(b))
+	if na == 0 || nb == 0 {
+		return math.NaN()
+	}
+	type sample struct {
+		value float64
+		fromA bool
+	}
+	samples := make([]sample, 0, len(a)+len(b))
+	for _, v := range a {
+		samples = append(samples, sample{v, true})
+	}
+	for _, v := range b {
+		samples = append(samples, sample{v, false})
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i].value < samples[j].value })
+	// Tied values share the average of their ranks.
+	var rankSumA, ties float64
+	for i := 0; i < len(samples); {
+		j := i + 1
+		for j < len(samples) && samples[j].value == samples[i].value {
+			j++
+		}
+		rank := float64(i+j+1) / 2
+		for k := i; k < j; k++ {
+			if samples[k].fromA {
+				rankSumA += rank
+			}
+		}
+		t := float64(j - i)
+		ties += t*t*t - t
+		i = j
+	}
+	n := na + nb
+	u := rankSumA - na*(na+1)/2
+	mean := na * nb / 2
+	sigma := math.Sqrt(na * nb / 12 * ((n + 1) - ties/(n*(n-1))))
+	if sigma == 0 {
+		return 1
+	}
+	z := math.Max(0, math.Abs(u-mean)-0.5) / sigma
+	return math.Erfc(z / math.Sqrt2)
+}
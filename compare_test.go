@@ -0,0 +1,62 @@
+package olbermann
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// runOf makes a Run of one column with the given values, a second apart.
+func runOf(column string, values ...float64) (run *Run) {
+	run = &Run{Columns: []string{column}}
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, v := range values {
+		run.Times = append(run.Times, start.Add(time.Duration(i)*time.Second))
+		run.Rows = append(run.Rows, []float64{v})
+	}
+	return
+}
+
+func TestMannWhitney(t *testing.T) {
+	// U=3, mean 12.5, sigma 4.787, so z=(9.5-0.5)/4.787=1.880.
+	p := mannWhitney([]float64{1, 2, 3, 4, 8}, []float64{5, 6, 7, 9, 10})
+	if math.Abs(p-0.0601) > 0.001 {
+		t.Error("expected p of about 0.060, got", p)
+	}
+	if p := mannWhitney([]float64{1, 1, 1}, []float64{1, 1, 1}); p != 1 {
+		t.Error("expected p of 1 for identical samples, got", p)
+	}
+	if p := mannWhitney(nil, []float64{1}); !math.IsNaN(p) {
+		t.Error("expected NaN for an empty sample, got", p)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	old := runOf("Transactions iter", 100, 102, 98, 101, 99, 100, 103, 97, 100, 100)
+	old.Columns = append(old.Columns, "Only old")
+	for i := range old.Rows {
+		old.Rows[i] = append(old.Rows[i], 1)
+	}
+	faster := runOf("Transactions iter", 110, 112, 108, 111, 109, 110, 113, 107, 110, 110)
+	same := runOf("Transactions iter", 101, 99, 100, 102, 98, 100, 97, 103, 100, 100)
+
+	cs := Compare(old, faster)
+	if len(cs) != 1 {
+		t.Fatal("expected to compare only the column in common, got", cs)
+	}
+	c := cs[0]
+	if c.Delta != 10 || math.Abs(c.Change()-0.1) > 1e-9 {
+		t.Error("expected a 10% change, got", c.Delta, c.Change())
+	}
+	if !(c.Low < 10 && c.High > 10 && c.Low > 7) {
+		t.Error("unexpected confidence interval", c.Low, c.High)
+	}
+	if !c.Significant(0.05) {
+		t.Error("expected a significant change, got p", c.P)
+	}
+
+	c = Compare(old, same)[0]
+	if c.Delta != 0 || c.Low >= 0 || c.High <= 0 || c.Significant(0.05) {
+		t.Error("expected no significant change, got", c)
+	}
+}
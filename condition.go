@@ -0,0 +1,150 @@
+package olbermann
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A Condition compares one report of a metric with a threshold, as in
+// "Latency w99 > 50ms" or "Transactions cum >= 5K/s".
+//
+// The threshold may have a K/M/G/T prefix and a unit.  A time unit (ns, us,
+// ms or s) is converted to the metric's time unit, any other unit must
+// match the metric's "unit" tag.  A trailing "/s" is allowed for rates and
+// ignored.
+type Condition struct {
+	Metric    string  // The metric's Name or FullName
+	Report    string  // The report to compare
+	Op        string  // One of <, <=, >, >=
+	Threshold float64 // The threshold, in Unit
+	Unit      string  // The threshold's unit, or "" for the metric's own
+}
+
+var conditionOps = []string{"<=", ">=", "<", ">"}
+
+// ParseCondition parses a condition of the form "<metric> <report> <op>
+// <threshold>", such as "Latency c99 < 20ms".
+func ParseCondition(s string) (c Condition, err error) {
+	if c, err = parseCondition(s); err != nil {
+		return
+	}
+	if c.Metric == "" {
+		err = errors.New("condition " + strconv.Quote(s) + " must name a metric and a report")
+	}
+	return
+}
+
+// parseCondition parses a condition whose metric may be left out, as in
+// "w99 > 50ms".
+func parseCondition(s string) (c Condition, err error) {
+	opIndex := strings.IndexAny(s, "<>")
+	if opIndex < 0 {
+		err = errors.New("condition " + strconv.Quote(s) + " has no comparison, must use one of <, <=, > or >=")
+		return
+	}
+	for _, op := range conditionOps {
+		if strings.HasPrefix(s[opIndex:], op) {
+			c.Op = op
+			break
+		}
+	}
+	switch lhs := strings.Fields(s[:opIndex]); len(lhs) {
+	case 1:
+		c.Report = lhs[0]
+	case 2:
+		c.Metric, c.Report = lhs[0], lhs[1]
+	default:
+		err = errors.New("condition " + strconv.Quote(s) + " must compare a metric's report")
+		return
+	}
+	if c.Threshold, c.Unit, err = parseThreshold(strings.TrimSpace(s[opIndex+len(c.Op):])); err != nil {
+		err = errors.New("condition " + strconv.Quote(s) + " has " + err.Error())
+	}
+	return
+}
+
+func parseThreshold(s string) (threshold float64, unit string, err error) {
+	s = strings.TrimSuffix(s, "/s")
+	end := 0
+	for end < len(s) && (s[end] >= '0' && s[end] <= '9' || s[end] == '.' || s[end] == '-' || s[end] == '+' || s[end] == 'e' && end > 0) {
+		end++
+	}
+	if threshold, err = strconv.ParseFloat(s[:end], 64); err != nil {
+		err = errors.New("invalid threshold " + strconv.Quote(s))
+		return
+	}
+	unit = strings.TrimSpace(s[end:])
+	if isTimeUnit(unit) {
+		return
+	}
+	for i := range siPrefixes {
+		if strings.HasPrefix(unit, siPrefixes[i].prefix) {
+			threshold *= siPrefixes[i].value
+			unit = unit[len(siPrefixes[i].prefix):]
+			break
+		}
+	}
+	return
+}
+
+func isTimeUnit(unit string) bool {
+	for i := range timeUnits {
+		if timeUnits[i].unit == unit {
+			return true
+		}
+	}
+	return false
+}
+
+func secondsPer(unit string) float64 {
+	for i := range timeUnits {
+		if timeUnits[i].unit == unit {
+			return timeUnits[i].seconds
+		}
+	}
+	return 0
+}
+
+// thresholdIn returns the threshold converted to unit, the unit of the
+// metric it is compared with.
+func (c *Condition) thresholdIn(unit string) (float64, error) {
+	switch {
+	case c.Unit == "" || c.Unit == unit:
+		return c.Threshold, nil
+	case isTimeUnit(c.Unit) && isTimeUnit(unit):
+		return c.Threshold * secondsPer(c.Unit) / secondsPer(unit), nil
+	case unit == "":
+		return 0, errors.New("threshold of " + c.String() + " has unit " + c.Unit + " but the metric has none")
+	default:
+		return 0, errors.New("threshold of " + c.String() + " has unit " + c.Unit + " but the metric is in " + unit)
+	}
+}
+
+// holds reports whether value, in unit, satisfies the condition.
+func (c *Condition) holds(value float64, unit string) (bool, error) {
+	threshold, err := c.thresholdIn(unit)
+	if err != nil {
+		return false, err
+	}
+	switch c.Op {
+	case "<":
+		return value < threshold, nil
+	case "<=":
+		return value <= threshold, nil
+	case ">":
+		return value > threshold, nil
+	default:
+		return value >= threshold, nil
+	}
+}
+
+// matches reports whether m is the metric the condition is about.
+func (c *Condition) matches(m *MetricSnapshot) bool {
+	return c.Metric == m.Name || c.Metric == m.FullName()
+}
+
+func (c Condition) String() string {
+	return fmt.Sprintf("%s %s %s %s%s", c.Metric, c.Report, c.Op, strconv.FormatFloat(c.Threshold, 'g', -1, 64), c.Unit)
+}
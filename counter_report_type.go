@@ -1,11 +1,11 @@
 package olbermann
 
 import (
-	"errors"
 	"fmt"
 	"github.com/VividCortex/ewma"
+	"math"
 	"reflect"
-	"strings"
+	"strconv"
 	"time"
 )
 
@@ -24,16 +24,21 @@ func (t *iterCounterReportType) add(fval reflect.Value) {
 
 func (t *iterCounterReportType) get(iterDuration time.Duration, cumDuration time.Duration) (res float64) {
 	res = (t.value - t.lastReportedValue) / iterDuration.Seconds()
-	t.lastReportedValue = t.value
 	return
 }
 
+func (t *iterCounterReportType) roll() {
+	t.lastReportedValue = t.value
+}
+
 func (t *iterCounterReportType) string(val float64) string {
 	return fmt.Sprintf("%.2f", val)
 }
 
 func (t *iterCounterReportType) close() {}
 
+func (t *iterCounterReportType) perSecond() {}
+
 type cumulativeCounterReportType struct {
 	value float64
 }
@@ -51,12 +56,16 @@ func (t *cumulativeCounterReportType) get(iterDuration time.Duration, cumDuratio
 	return
 }
 
+func (t *cumulativeCounterReportType) roll() {}
+
 func (t *cumulativeCounterReportType) string(val float64) string {
 	return fmt.Sprintf("%.2f", val)
 }
 
 func (t *cumulativeCounterReportType) close() {}
 
+func (t *cumulativeCounterReportType) perSecond() {}
+
 type totalCounterReportType struct {
 	value float64
 }
@@ -74,41 +83,42 @@ func (t *totalCounterReportType) get(iterDuration time.Duration, cumDuration tim
 	return
 }
 
+func (t *totalCounterReportType) roll() {}
+
 func (t *totalCounterReportType) string(val float64) string {
 	return fmt.Sprintf("%d", int64(val))
 }
 
 func (t *totalCounterReportType) close() {}
 
+// An ewmaCounterReportType is a moving average of a counter's rate per
+// second, decaying over decaySamples seconds.  It is driven by the
+// Reporter's intervals, rather than by a clock of its own.
 type ewmaCounterReportType struct {
 	nameString        string
 	value             float64
+	lastReportedValue float64
 	avg               ewma.MovingAverage
-	killer            chan<- bool
 }
 
 func newEwmaCounterReportType(decaySamples int) (res *ewmaCounterReportType) {
-	kill := make(chan bool)
-	res = &ewmaCounterReportType{nameString: fmt.Sprintf("ewma%d", decaySamples/60), avg: ewma.NewMovingAverage(float64(decaySamples)), killer: kill}
-	go func() {
-		ticks := time.Tick(time.Second)
-		lastTick := time.Now()
-		lastReportedValue := res.value
-		for {
-			select {
-			case <-kill:
-				close(kill)
-				return
-			case tick := <-ticks:
-				res.avg.Add((res.value - lastReportedValue) / tick.Sub(lastTick).Seconds())
-				lastReportedValue = res.value
-				lastTick = tick
-			}
-		}
-	}()
+	res = &ewmaCounterReportType{nameString: fmt.Sprintf("ewma%d", decaySamples/60), avg: ewma.NewMovingAverage(float64(decaySamples))}
 	return
 }
 
+// tick adds the rate over the interval just ended to the average, once
+// for each second the interval lasted.
+func (t *ewmaCounterReportType) tick(iterDuration time.Duration) {
+	if iterDuration <= 0 {
+		return
+	}
+	rate := (t.value - t.lastReportedValue) / iterDuration.Seconds()
+	t.lastReportedValue = t.value
+	for n := math.Max(1, math.Round(iterDuration.Seconds())); n > 0; n-- {
+		t.avg.Add(rate)
+	}
+}
+
 func (t *ewmaCounterReportType) name() string {
 	return t.nameString
 }
@@ -122,40 +132,41 @@ func (t *ewmaCounterReportType) get(iterDuration time.Duration, cumDuration time
 	return
 }
 
+func (t *ewmaCounterReportType) roll() {}
+
 func (t *ewmaCounterReportType) string(val float64) string {
 	return fmt.Sprintf("%.2f", val)
 }
 
-func (t *ewmaCounterReportType) close() {
-	t.killer <- true
+func (t *ewmaCounterReportType) close() {}
+
+func (t *ewmaCounterReportType) perSecond() {}
+
+// counterReports are the reports a counter metric may request, by name.
+var counterReports = map[string]func() reportType{
+	"iter":   func() reportType { return new(iterCounterReportType) },
+	"cum":    func() reportType { return new(cumulativeCounterReportType) },
+	"ewma1":  func() reportType { return newEwmaCounterReportType(60) },
+	"ewma5":  func() reportType { return newEwmaCounterReportType(300) },
+	"ewma15": func() reportType { return newEwmaCounterReportType(900) },
+	"ewma60": func() reportType { return newEwmaCounterReportType(3600) },
+	"total":  func() reportType { return new(totalCounterReportType) },
 }
 
-func newCounterMetric(field reflect.StructField) (metric metricType, err error) {
-	reportNames := strings.Split(field.Tag.Get("report"), ",")
-	if len(reportNames) < 1 {
-		err = errors.New("counter metric " + field.Name + " must define reports")
-		return
-	}
-	reports := make([]reportType, len(reportNames))
+func newCounterMetric(field reflect.StructField, errs *fieldErrors) (metric *metricType) {
+	reportNames := splitReportNames(field, errs)
 	for j := range reportNames {
-		switch reportNames[j] {
-		case "iter":
-			reports[j] = new(iterCounterReportType)
-		case "cum":
-			reports[j] = new(cumulativeCounterReportType)
-		case "ewma1":
-			reports[j] = newEwmaCounterReportType(60)
-		case "ewma5":
-			reports[j] = newEwmaCounterReportType(300)
-		case "ewma15":
-			reports[j] = newEwmaCounterReportType(900)
-		case "ewma60":
-			reports[j] = newEwmaCounterReportType(3600)
-		case "total":
-			reports[j] = new(totalCounterReportType)
+		if _, ok := counterReports[reportNames[j]]; !ok {
+			errs.add(field, "report", "unknown counter report "+strconv.Quote(reportNames[j])+", must be one of iter, cum, total, ewma1, ewma5, ewma15 or ewma60")
+		}
+	}
+	newReports := func() []reportType {
+		reports := make([]reportType, len(reportNames))
+		for j := range reportNames {
+			reports[j] = counterReports[reportNames[j]]()
 		}
+		return reports
 	}
-	metric.name = field.Name
-	metric.reports = reports
+	metric = &metricType{name: field.Name, reportNames: reportNames, newReports: newReports}
 	return
 }
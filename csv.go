@@ -1,15 +1,67 @@
 package olbermann
 
 import (
-	"bufio"
+	"bytes"
+	"encoding/csv"
 	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+	"sync"
 	"time"
 )
 
-// CsvStyler is a Styler that produces output in csv format.
+// A CsvTimeFormat is how CsvStyler writes the time of each row.
+type CsvTimeFormat int
+
+const (
+	CsvRFC3339 CsvTimeFormat = iota // As in 2014-04-12T00:41:06.921153316-04:00
+	CsvUnix                         // Seconds since the Unix epoch
+	CsvElapsed                      // Seconds since the Reporter started, in a column named "elapsed"
+)
+
+// A CsvPrecision is how many digits CsvStyler writes after the decimal
+// point.
+type CsvPrecision int
+
+const (
+	CsvSixDigits CsvPrecision = iota // Six, as %f does
+	CsvDigits                        // Exactly CsvStyler's Digits, which may be 0
+	CsvShortest                      // As many as needed to read each value back exactly
+)
+
+// CsvStyler is a Styler that produces output in csv format, as described
+// in RFC 4180.
+//
+// Each row starts with its time, then, if asked for, its sequence number
+// in a column named "seq" and the length of its interval in seconds in a
+// column named "interval", then the value of each report of each metric
+// series.  Values are written with as many digits after the decimal point
+// as Precision says, unless the series has a format tag.
+//
+// Since every row has the same columns, a CsvStyler can only be started for
+// one metric struct type; Start returns an error if it is started for
+// another.
 type CsvStyler struct {
-	Period              time.Duration // How often to print
-	Writer              *bufio.Writer   // A writer to print to
+	Period     time.Duration // How often to print
+	Writer     io.Writer     // A writer to print to, flushed after each row if it has a Flush method
+	TimeFormat CsvTimeFormat // How to write times
+	Comma      rune          // The field delimiter, ',' if 0
+	Precision  CsvPrecision  // How many digits to write after the decimal point
+	Digits     int           // The number of digits after the decimal point, with CsvDigits
+	Sequence   bool          // Number the rows, from 1
+	Interval   bool          // Write the length of each row's interval
+	Err        error         // The first error writing, after which nothing more is written
+	lock       sync.Mutex
+	rtype      reflect.Type // The metric type started for
+	w          *csv.Writer
+	seq        int
+}
+
+// flusher is a Writer that buffers, such as a *bufio.Writer.
+type flusher interface {
+	Flush() error
 }
 
 func (s *CsvStyler) period() time.Duration {
@@ -20,41 +72,125 @@ func (s *CsvStyler) linesBetweenHeaders() int {
 	return 0
 }
 
-func (s *CsvStyler) printHeader(mst *metricSetType) {
-	s.Writer.WriteString("time")
-	for i := range mst.metrics {
-		mt := mst.metrics[i]
-		s.Writer.WriteString(",")
-		for j := range mt.reports {
-			rt := mt.reports[j]
-			if j > 0 {
-				s.Writer.WriteString(",")
-			}
-			s.Writer.WriteString("\"")
-			s.Writer.WriteString(mt.name)
-			s.Writer.WriteString(" ")
-			s.Writer.WriteString(rt.name())
-			s.Writer.WriteString("\"")
+func (s *CsvStyler) claim(rtype reflect.Type) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.rtype != nil && s.rtype != rtype {
+		return fmt.Errorf("olbermann: a CsvStyler can only print one metric type, and was already started for %s", s.rtype)
+	}
+	s.rtype = rtype
+	return nil
+}
+
+func (s *CsvStyler) err() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.Err
+}
+
+func (s *CsvStyler) printHeader(msv *metricSetValue) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	record := []string{"time"}
+	if s.TimeFormat == CsvElapsed {
+		record[0] = "elapsed"
+	}
+	if s.Sequence {
+		record = append(record, "seq")
+	}
+	if s.Interval {
+		record = append(record, "interval")
+	}
+	for i := range msv.metrics {
+		mv := &msv.metrics[i]
+		for j := range mv.reports {
+			record = append(record, mv.fullName()+" "+mv.reports[j].name)
 		}
 	}
-	s.Writer.WriteString("\n")
+	hw, ok := s.Writer.(headerWriter)
+	if !ok || s.Err != nil {
+		s.write(record)
+		return
+	}
+	var buf bytes.Buffer
+	w := s.newWriter(&buf)
+	w.Write(record)
+	w.Flush()
+	if s.Err = hw.writeHeader(buf.Bytes()); s.Err == nil {
+		s.flush()
+	}
 }
 
-func (s *CsvStyler) printValues(curTime time.Time, mst *metricSetType, msv *metricSetValue) {
-	s.Writer.WriteString("\"")
-	s.Writer.WriteString(curTime.String())
-	s.Writer.WriteString("\"")
+func (s *CsvStyler) printValues(curTime time.Time, msv *metricSetValue) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var record []string
+	switch s.TimeFormat {
+	case CsvUnix:
+		record = append(record, fmt.Sprintf("%d.%09d", curTime.Unix(), curTime.Nanosecond()))
+	case CsvElapsed:
+		record = append(record, strconv.FormatFloat(msv.cumDuration.Seconds(), 'f', -1, 64))
+	default:
+		record = append(record, curTime.Format(time.RFC3339Nano))
+	}
+	if s.Sequence {
+		s.seq++
+		record = append(record, strconv.Itoa(s.seq))
+	}
+	if s.Interval {
+		record = append(record, strconv.FormatFloat(msv.iterDuration.Seconds(), 'f', -1, 64))
+	}
 	for i := range msv.metrics {
-		mv := msv.metrics[i]
-		s.Writer.WriteString(",")
+		mv := &msv.metrics[i]
 		for j := range mv.reports {
-			rv := mv.reports[j]
-			if j > 0 {
-				s.Writer.WriteString(",")
-			}
-			s.Writer.WriteString(fmt.Sprintf("%f", rv.value))
+			record = append(record, s.value(mv, mv.reports[j].value))
 		}
 	}
-	s.Writer.WriteString("\n")
-	s.Writer.Flush()
+	s.write(record)
+}
+
+// value formats val, a value of mv.
+func (s *CsvStyler) value(mv *metricValue, val float64) string {
+	switch {
+	case mv.format.format != "" || math.IsNaN(val) || math.IsInf(val, 0):
+		return mv.format.plain(val, "%f")
+	case s.Precision == CsvDigits:
+		return strconv.FormatFloat(val, 'f', s.Digits, 64)
+	case s.Precision == CsvShortest:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	}
+	return strconv.FormatFloat(val, 'f', 6, 64)
+}
+
+// write writes record as a row and flushes it through to Writer.
+func (s *CsvStyler) write(record []string) {
+	if s.Err != nil {
+		return
+	}
+	if s.w == nil {
+		s.w = s.newWriter(s.Writer)
+	}
+	if s.Err = s.w.Write(record); s.Err != nil {
+		return
+	}
+	s.w.Flush()
+	if s.Err = s.w.Error(); s.Err == nil {
+		s.flush()
+	}
+}
+
+// newWriter returns a csv.Writer to w with the delimiter.
+func (s *CsvStyler) newWriter(w io.Writer) (cw *csv.Writer) {
+	cw = csv.NewWriter(w)
+	if s.Comma != 0 {
+		cw.Comma = s.Comma
+	}
+	return
+}
+
+// flush flushes Writer, if it has a Flush method.
+func (s *CsvStyler) flush() {
+	if f, ok := s.Writer.(flusher); ok {
+		s.Err = f.Flush()
+	}
 }
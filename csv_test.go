@@ -0,0 +1,123 @@
+package olbermann
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+type csvMetric struct {
+	Ops   int     `type:"counter" report:"iter,total" name:"ops, all"`
+	Ratio float64 `type:"counter" report:"total" format:"%.1f"`
+}
+
+func TestCsvStyler(t *testing.T) {
+	var buf bytes.Buffer
+	s := &CsvStyler{Writer: &buf, TimeFormat: CsvUnix, Comma: ';', Precision: CsvDigits, Digits: 2, Sequence: true, Interval: true}
+	r := &Reporter{}
+	tr := startTestRun(t, r, csvMetric{}, s)
+	tr.start = time.Unix(1600000000, 500000000)
+	for i := 1; i <= 2; i++ {
+		tr.interval(csvMetric{Ops: 3, Ratio: 0.25})
+	}
+	r.Close()
+	if s.Err != nil {
+		t.Fatal(s.Err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected a header and 2 lines of values, got\n%s", buf.String())
+	}
+	if expected := `time;seq;interval;ops, all iter;ops, all total;Ratio total`; lines[0] != expected {
+		t.Errorf("expected header %q, got %q", expected, lines[0])
+	}
+	if expected := `1600000002.500000000;2;1;3.00;6.00;0.5`; lines[2] != expected {
+		t.Errorf("expected values %q, got %q", expected, lines[2])
+	}
+
+	run, err := ReadRun(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(run.Columns) != 3 || run.Columns[0] != "ops, all iter" {
+		t.Fatal("expected only value columns, got", run.Columns)
+	}
+	if !run.Times[1].Equal(time.Unix(1600000000, 500000000).Add(2*time.Second)) || run.Rows[1][1] != 6 {
+		t.Error("unexpected rows", run.Times, run.Rows)
+	}
+}
+
+func TestCsvStylerElapsed(t *testing.T) {
+	var buf bytes.Buffer
+	s := &CsvStyler{Writer: &buf, TimeFormat: CsvElapsed, Precision: CsvShortest}
+	r := &Reporter{}
+	startTestRun(t, r, csvMetric{}, s).interval(csvMetric{Ops: 1})
+	r.Close()
+	out := buf.String()
+	if !strings.HasPrefix(out, `elapsed,"ops, all iter",`) {
+		t.Errorf("expected an elapsed column and quoted names, got\n%s", out)
+	}
+	run, err := ReadCsv(strings.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(run.Times) != 1 || run.Times[0].Sub(time.Time{}) <= 0 || run.Rows[0][1] != 1 {
+		t.Error("unexpected rows", run.Times, run.Rows)
+	}
+}
+
+func TestCsvStylerPrecision(t *testing.T) {
+	type precisionMetric struct {
+		X float64 `type:"counter" report:"total"`
+	}
+	for _, c := range []struct {
+		s        *CsvStyler
+		expected string
+	}{
+		{&CsvStyler{}, "0.125000"},
+		{&CsvStyler{Precision: CsvDigits}, "0"},
+		{&CsvStyler{Precision: CsvDigits, Digits: 2}, "0.12"},
+		{&CsvStyler{Precision: CsvShortest, Digits: 2}, "0.125"},
+	} {
+		var buf bytes.Buffer
+		c.s.Writer = &buf
+		r := &Reporter{}
+		startTestRun(t, r, precisionMetric{}, c.s).interval(precisionMetric{0.125})
+		r.Close()
+		if lines := strings.Split(strings.TrimSpace(buf.String()), "\n"); len(lines) != 2 || !strings.HasSuffix(lines[1], ","+c.expected) {
+			t.Errorf("expected %s with precision %d and %d digits, got\n%s", c.expected, c.s.Precision, c.s.Digits, buf.String())
+		}
+	}
+}
+
+func TestCsvStylerOneType(t *testing.T) {
+	type otherMetric struct {
+		Ops int `type:"counter" report:"total"`
+	}
+	var buf bytes.Buffer
+	s := &CsvStyler{Writer: &buf}
+	r := &Reporter{}
+	tr := startTestRun(t, r, csvMetric{}, s)
+	if err := r.Start(&csvMetric{}, s); err != nil {
+		t.Error("expected to start again for the same type, got", err)
+	}
+	if err := r.Start(otherMetric{}, s); err == nil {
+		t.Error("expected an error starting for a second type")
+	}
+	if err := r.Start(otherMetric{}, &MultiStyler{Sinks: []Sink{{Styler: s}}}); err == nil {
+		t.Error("expected an error starting a MultiStyler for a second type with the same CsvStyler")
+	}
+	ms := &MultiStyler{Sinks: []Sink{{Styler: &CsvStyler{Writer: &bytes.Buffer{}}}}}
+	if err := r.Start(csvMetric{}, ms); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Start(otherMetric{}, ms); err == nil {
+		t.Error("expected an error starting a MultiStyler with a CsvStyler for a second type")
+	}
+	tr.interval(csvMetric{Ops: 1})
+	r.Close()
+	if _, err := ReadRun(&buf); err != nil {
+		t.Error("expected the file to read back, got", err)
+	}
+}
@@ -0,0 +1,312 @@
+package olbermann
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dashboardHistory is how many intervals a Dashboard keeps, to draw for
+// viewers who arrive partway through the run.
+const dashboardHistory = 600
+
+// dashboardBuffer is how many intervals a viewer may fall behind before
+// it misses some.
+const dashboardBuffer = 16
+
+// A Dashboard is a Styler that is also an http.Handler, serving a page
+// that charts every interval's values live as they are reported.
+//
+// The page reads the values as server-sent events from "events" next to
+// it, so the Dashboard may be mounted anywhere, as long as both paths reach
+// it.  Any number of people may watch at once.  A viewer who falls behind
+// misses intervals rather than holding up the Reporter.  Events are
+// numbered, so a page that reconnects only gets those it hasn't seen.
+//
+// Usage:
+// 	dash := &olbermann.Dashboard{Title: "insert benchmark"}
+// 	if err := r.Start(ReportableMetric{}, dash); err != nil {
+// 		return err
+// 	}
+// 	http.Handle("/olbermann/", http.StripPrefix("/olbermann", dash))
+// 	go http.ListenAndServe(":8080", nil)
+type Dashboard struct {
+	Period  time.Duration // How often to send values
+	Title   string        // The page's title, "olbermann" if empty
+	lock    sync.Mutex
+	history []dashboardEntry
+	seq     int
+	viewers map[chan dashboardEntry]bool
+}
+
+// A dashboardEntry is an encoded event and its number, the id the page
+// sends back as Last-Event-ID when it reconnects.
+type dashboardEntry struct {
+	id   int
+	data []byte
+}
+
+// A dashboardEvent is one interval's values of one metric set, as sent to
+// the page.
+type dashboardEvent struct {
+	Set     string            `json:"set"`
+	Time    time.Time         `json:"time"`
+	Elapsed float64           `json:"elapsed"` // In seconds
+	Metrics []dashboardMetric `json:"metrics"`
+	Done    bool              `json:"done,omitempty"` // Set after the Reporter is closed
+}
+
+type dashboardMetric struct {
+	Name    string     `json:"name"`
+	Reports []string   `json:"reports"`
+	Values  []*float64 `json:"values"` // null where not a number
+	Texts   []string   `json:"texts"`  // The values formatted like the metric's
+}
+
+func (d *Dashboard) period() time.Duration {
+	return d.Period
+}
+
+func (d *Dashboard) linesBetweenHeaders() int {
+	return -1
+}
+
+func (d *Dashboard) printHeader(msv *metricSetValue) {}
+
+func (d *Dashboard) printValues(curTime time.Time, msv *metricSetValue) {
+	ev := dashboardEvent{Time: curTime, Elapsed: msv.cumDuration.Seconds()}
+	// Values rendered from a Run have no set.
+	if msv.rtype != nil {
+		ev.Set = msv.rtype.String()
+	}
+	for i := range msv.metrics {
+		mv := &msv.metrics[i]
+		dm := dashboardMetric{Name: mv.fullName(), Reports: make([]string, len(mv.reports)), Values: make([]*float64, len(mv.reports)), Texts: make([]string, len(mv.reports))}
+		for j := range mv.reports {
+			dm.Reports[j] = mv.reports[j].name
+			if v := mv.reports[j].value; !math.IsNaN(v) && !math.IsInf(v, 0) {
+				dm.Values[j] = &v
+				dm.Texts[j] = mv.format.tagged(mv.reports[j].rt, v, formatAxis)
+			}
+		}
+		ev.Metrics = append(ev.Metrics, dm)
+	}
+	d.send(&ev)
+}
+
+func (d *Dashboard) printFinal(report *finalReport) {
+	d.send(&dashboardEvent{Time: report.snapshot.Time, Elapsed: report.snapshot.Elapsed.Seconds(), Done: true})
+}
+
+// send encodes ev once and hands it to every viewer with room for it.
+func (d *Dashboard) send(ev *dashboardEvent) {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if len(d.history) >= dashboardHistory {
+		d.history = append(d.history[:0], d.history[len(d.history)-dashboardHistory+1:]...)
+	}
+	d.seq++
+	entry := dashboardEntry{d.seq, data}
+	d.history = append(d.history, entry)
+	for viewer := range d.viewers {
+		select {
+		case viewer <- entry:
+		default:
+		}
+	}
+}
+
+// ServeHTTP serves the page, or the stream of values at "events".
+func (d *Dashboard) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if strings.HasSuffix(req.URL.Path, "/events") {
+		d.serveEvents(w, req)
+		return
+	}
+	title := d.Title
+	if title == "" {
+		title = "olbermann"
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	dashboardTemplate.Execute(w, title)
+}
+
+func (d *Dashboard) serveEvents(w http.ResponseWriter, req *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	// A reconnecting page already has the events up to the last it saw.
+	seen, _ := strconv.Atoi(req.Header.Get("Last-Event-ID"))
+	viewer := make(chan dashboardEntry, dashboardBuffer)
+	d.lock.Lock()
+	var history []dashboardEntry
+	for _, entry := range d.history {
+		if entry.id > seen {
+			history = append(history, entry)
+		}
+	}
+	if d.viewers == nil {
+		d.viewers = make(map[chan dashboardEntry]bool)
+	}
+	d.viewers[viewer] = true
+	d.lock.Unlock()
+	defer func() {
+		d.lock.Lock()
+		delete(d.viewers, viewer)
+		d.lock.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	for i := range history {
+		history[i].writeTo(w)
+	}
+	flusher.Flush()
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case entry := <-viewer:
+			if err := entry.writeTo(w); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// writeTo writes the entry as a server-sent event.
+func (entry *dashboardEntry) writeTo(w io.Writer) (err error) {
+	_, err = fmt.Fprintf(w, "id: %d\ndata: %s\n\n", entry.id, entry.data)
+	return
+}
+
+var dashboardTemplate = template.Must(template.New("dashboard").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.}}</title>
+<style>
+body { font-family: sans-serif; margin: 1em 2em; color: #222; }
+#status { color: #888; }
+.panel { display: inline-block; margin: 0 1em 1em 0; vertical-align: top; }
+.panel h3 { font-size: 13px; margin: 0.3em 0; }
+.legend span { font-size: 11px; margin-right: 1em; }
+</style>
+</head>
+<body>
+<h1>{{.}}</h1>
+<p id="status">connecting...</p>
+<div id="panels"></div>
+<script>
+var colors = ["#1f77b4", "#ff7f0e", "#2ca02c", "#d62728", "#9467bd", "#8c564b", "#e377c2", "#7f7f7f"];
+var maxPoints = 300;
+var panels = {};
+
+function panelFor(set, m) {
+	var key = set + " " + m.name;
+	var p = panels[key];
+	if (p) {
+		return p;
+	}
+	var div = document.createElement("div");
+	div.className = "panel";
+	var h = document.createElement("h3");
+	h.textContent = m.name;
+	div.appendChild(h);
+	var canvas = document.createElement("canvas");
+	canvas.width = 420;
+	canvas.height = 140;
+	div.appendChild(canvas);
+	var legend = document.createElement("div");
+	legend.className = "legend";
+	var labels = m.reports.map(function(r, i) {
+		var s = document.createElement("span");
+		s.style.color = colors[i % colors.length];
+		s.textContent = r;
+		legend.appendChild(s);
+		return s;
+	});
+	div.appendChild(legend);
+	document.getElementById("panels").appendChild(div);
+	p = panels[key] = {canvas: canvas, reports: m.reports, labels: labels, points: []};
+	return p;
+}
+
+function draw(p) {
+	var c = p.canvas.getContext("2d"), w = p.canvas.width, h = p.canvas.height, left = 50;
+	c.clearRect(0, 0, w, h);
+	// Label the axis with the extremes as the server formatted them.
+	var lo = 0, hi = -Infinity, loText = "0", hiText = "";
+	p.points.forEach(function(pt) {
+		pt.values.forEach(function(v, k) {
+			if (v === null) { return; }
+			if (v < lo) { lo = v; loText = pt.texts[k]; }
+			if (v > hi) { hi = v; hiText = pt.texts[k]; }
+		});
+	});
+	if (!(hi > lo)) { hi = lo + 1; hiText = ""; }
+	c.strokeStyle = "#ccc";
+	c.strokeRect(left, 0.5, w - left - 1, h - 1);
+	c.fillStyle = "#444";
+	c.font = "10px sans-serif";
+	c.textAlign = "right";
+	c.fillText(hiText, left - 4, 10);
+	c.fillText(loText, left - 4, h - 2);
+	if (p.points.length < 2) {
+		return;
+	}
+	var t0 = p.points[0].elapsed, span = p.points[p.points.length - 1].elapsed - t0 || 1;
+	p.reports.forEach(function(r, k) {
+		c.strokeStyle = colors[k % colors.length];
+		c.beginPath();
+		var drawing = false;
+		p.points.forEach(function(pt) {
+			var v = pt.values[k];
+			if (v === null || v === undefined) { drawing = false; return; }
+			var x = left + (w - left) * (pt.elapsed - t0) / span, y = h - (h - 2) * (v - lo) / (hi - lo) - 1;
+			if (drawing) { c.lineTo(x, y); } else { c.moveTo(x, y); drawing = true; }
+		});
+		c.stroke();
+	});
+}
+
+var source = new EventSource("events");
+source.onopen = function() { document.getElementById("status").textContent = "live"; };
+source.onerror = function() { document.getElementById("status").textContent = "disconnected, retrying..."; };
+source.onmessage = function(e) {
+	var ev = JSON.parse(e.data);
+	if (ev.done) {
+		document.getElementById("status").textContent = "finished after " + ev.elapsed.toFixed(0) + "s";
+		source.close();
+		return;
+	}
+	document.getElementById("status").textContent = "live, " + ev.elapsed.toFixed(0) + "s at " + new Date(ev.time).toLocaleTimeString();
+	ev.metrics.forEach(function(m) {
+		var p = panelFor(ev.set, m);
+		p.points.push({elapsed: ev.elapsed, values: m.values, texts: m.texts});
+		m.texts.forEach(function(t, k) {
+			p.labels[k].textContent = p.reports[k] + (t ? " " + t : "");
+		});
+		if (p.points.length > maxPoints) {
+			p.points.shift();
+		}
+		draw(p);
+	});
+};
+</script>
+</body>
+</html>
+`))
@@ -0,0 +1,164 @@
+package olbermann
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readEvent reads the next server-sent event from rd.
+func readEvent(t *testing.T, rd *bufio.Reader) (ev dashboardEvent) {
+	_, ev = readEventID(t, rd)
+	return
+}
+
+// readEventID reads the next server-sent event from rd, and its id.
+func readEventID(t *testing.T, rd *bufio.Reader) (id string, ev dashboardEvent) {
+	for {
+		line, err := rd.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.HasPrefix(line, "id: ") {
+			id = strings.TrimSpace(line[len("id: "):])
+		}
+		if strings.HasPrefix(line, "data: ") {
+			if err := json.Unmarshal([]byte(line[len("data: "):]), &ev); err != nil {
+				t.Fatal(err)
+			}
+			return
+		}
+	}
+}
+
+func TestDashboard(t *testing.T) {
+	dash := &Dashboard{Title: "test run"}
+	r := &Reporter{}
+	tr := startTestRun(t, r, recordedMetric{}, dash)
+	tr.interval(recordedMetric{Op: "get", Ops: 3, Latency: 1})
+
+	mux := http.NewServeMux()
+	mux.Handle("/olbermann/", http.StripPrefix("/olbermann", dash))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/olbermann/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(page), "<title>test run</title>") || !strings.Contains(string(page), `new EventSource("events")`) {
+		t.Errorf("unexpected page\n%s", page)
+	}
+
+	// Two viewers at once, the second never reading.
+	resp, err = http.Get(srv.URL + "/olbermann/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Error("unexpected content type", ct)
+	}
+	stalled, err := http.Get(srv.URL + "/olbermann/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stalled.Body.Close()
+	rd := bufio.NewReader(resp.Body)
+	ev := readEvent(t, rd)
+	if ev.Set != "olbermann.recordedMetric" || len(ev.Metrics) != 2 || ev.Metrics[0].Name != "Ops{op=get}" {
+		t.Fatal("expected the interval so far, got", ev)
+	}
+	if v := ev.Metrics[0].Values[1]; v == nil || *v != 3 || ev.Metrics[0].Texts[1] != "3" {
+		t.Error("expected a total of 3, got", v, ev.Metrics[0].Texts)
+	}
+
+	ticked := make(chan bool)
+	go func() {
+		for i := 2; i < 2+dashboardBuffer*4; i++ {
+			tr.interval(recordedMetric{Op: "get", Ops: 1, Latency: 1})
+		}
+		close(ticked)
+	}()
+	select {
+	case <-ticked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a stalled viewer not to hold up the Reporter")
+	}
+	if ev = readEvent(t, rd); !ev.Time.Equal(tr.start.Add(2 * time.Second)) {
+		t.Error("expected the next interval, got", ev.Time)
+	}
+	r.Close()
+	for !ev.Done {
+		ev = readEvent(t, rd)
+	}
+}
+
+func TestDashboardReconnect(t *testing.T) {
+	dash := &Dashboard{}
+	r := &Reporter{}
+	tr := startTestRun(t, r, recordedMetric{}, dash)
+	tr.interval(recordedMetric{Op: "get", Ops: 1})
+	tr.interval(recordedMetric{Op: "get", Ops: 1})
+	srv := httptest.NewServer(dash)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := readEventID(t, bufio.NewReader(resp.Body))
+	resp.Body.Close()
+	if id != "1" {
+		t.Fatal("expected the first event to be numbered 1, got", id)
+	}
+
+	// The page reconnects having seen only the first interval.
+	tr.interval(recordedMetric{Op: "get", Ops: 1})
+	req, _ := http.NewRequest("GET", srv.URL+"/events", nil)
+	req.Header.Set("Last-Event-ID", id)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	rd := bufio.NewReader(resp.Body)
+	r.Close()
+	var ids []string
+	for {
+		id, ev := readEventID(t, rd)
+		ids = append(ids, id)
+		if ev.Done {
+			break
+		}
+	}
+	if strings.Join(ids, ",") != "2,3,4" {
+		t.Error("expected only the events after the last seen, got", ids)
+	}
+}
+
+func TestDashboardRender(t *testing.T) {
+	run, err := ReadCsv(strings.NewReader(testCsv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dash := &Dashboard{}
+	run.Render(dash)
+	if len(dash.history) != 3 {
+		t.Fatalf("expected an event for each of 3 rows, got %d", len(dash.history))
+	}
+	var ev dashboardEvent
+	if err := json.Unmarshal(dash.history[2].data, &ev); err != nil {
+		t.Fatal(err)
+	}
+	if ev.Set != "" || len(ev.Metrics) != 3 || ev.Metrics[0].Name != "Ops" || *ev.Metrics[0].Values[0] != 30 {
+		t.Errorf("unexpected event %+v", ev)
+	}
+}
@@ -0,0 +1,156 @@
+package olbermann
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// derivedReportType reports the value of a derived metric's expression.
+// The "iter" report evaluates it over the other metrics' sums for the
+// interval, the "cum" report over their sums for the whole run.
+type derivedReportType struct {
+	nameString string
+}
+
+func (t *derivedReportType) name() string {
+	return t.nameString
+}
+
+func (t *derivedReportType) add(fval reflect.Value) {}
+
+// get is never used, derived values are computed by derivedMetric.evaluate.
+func (t *derivedReportType) get(iterDuration time.Duration, cumDuration time.Duration) float64 {
+	return 0
+}
+
+func (t *derivedReportType) roll() {}
+
+func (t *derivedReportType) string(val float64) string {
+	return fmt.Sprintf("%.2f", val)
+}
+
+func (t *derivedReportType) close() {}
+
+// A derivedMetric is a metric computed from other metrics of the same
+// struct, by a field tagged with "derived".
+type derivedMetric struct {
+	field reflect.StructField
+	e     expr
+	refs  []exprRef
+	// resolved references, by resolveDerived
+	targets     map[exprRef]*metricType
+	reportIndex map[exprRef]int
+}
+
+func newDerivedMetric(field reflect.StructField, errs *fieldErrors) (metric *metricType) {
+	dm := &derivedMetric{field: field}
+	var err error
+	if dm.e, dm.refs, err = parseExpr(field.Tag.Get("derived")); err != nil {
+		errs.add(field, "derived", err.Error())
+	}
+	if field.Name == "_" && field.Tag.Get("name") == "" {
+		errs.add(field, "derived", "derived metrics on blank fields must have a name")
+	}
+	reportNames := splitReportNames(field, errs)
+	for i := range reportNames {
+		if reportNames[i] != "iter" && reportNames[i] != "cum" {
+			errs.add(field, "report", "unknown derived report "+strconv.Quote(reportNames[i])+", must be iter or cum")
+		}
+	}
+	newReports := func() []reportType {
+		reports := make([]reportType, len(reportNames))
+		for i := range reportNames {
+			reports[i] = &derivedReportType{nameString: reportNames[i]}
+		}
+		return reports
+	}
+	metric = &metricType{name: field.Name, derived: dm, reportNames: reportNames, newReports: newReports}
+	return
+}
+
+// resolveDerived finds the metrics (and reports) referenced by derived
+// metrics, by name or by field name.  Metrics referred to without a report
+// are marked to keep sums, which must happen before any series is made.
+func (mst *metricSetType) resolveDerived(errs *fieldErrors) {
+	byName := make(map[string]*metricType)
+	for i := range mst.metrics {
+		byName[mst.metrics[i].field] = mst.metrics[i]
+	}
+	for i := range mst.metrics {
+		byName[mst.metrics[i].name] = mst.metrics[i]
+	}
+	for i := range mst.metrics {
+		dm := mst.metrics[i].derived
+		if dm == nil || dm.e == nil {
+			continue
+		}
+		dm.targets = make(map[exprRef]*metricType)
+		dm.reportIndex = make(map[exprRef]int)
+		for _, ref := range dm.refs {
+			target, ok := byName[ref.metric]
+			if !ok {
+				errs.add(dm.field, "derived", "unknown metric "+strconv.Quote(ref.metric))
+				continue
+			}
+			if target.derived != nil {
+				errs.add(dm.field, "derived", "cannot refer to derived metric "+strconv.Quote(ref.metric))
+				continue
+			}
+			dm.targets[ref] = target
+			if ref.report == "" {
+				target.summed = true
+				continue
+			}
+			dm.reportIndex[ref] = -1
+			for j := range target.reportNames {
+				if target.reportNames[j] == ref.report {
+					dm.reportIndex[ref] = j
+				}
+			}
+			if dm.reportIndex[ref] < 0 {
+				errs.add(dm.field, "derived", "metric "+strconv.Quote(ref.metric)+" has no report "+strconv.Quote(ref.report))
+			}
+		}
+	}
+}
+
+// evaluate computes mt's values from the values already collected for
+// every other metric, adding them to values.  There is one series for each
+// set of labels seen on any of the metrics the expression refers to.
+func (dm *derivedMetric) evaluate(mt *metricType, values map[*metricSeries][]float64) {
+	seen := make(map[string]bool)
+	var labels []string
+	for _, ref := range dm.refs {
+		target := dm.targets[ref]
+		for j := range target.series {
+			if l := target.series[j].labels; !seen[l] {
+				seen[l] = true
+				labels = append(labels, l)
+			}
+		}
+	}
+	for _, l := range labels {
+		ms := mt.seriesFor(l)
+		vals := make([]float64, len(ms.reports))
+		for k := range ms.reports {
+			cumulative := ms.reports[k].name() == "cum"
+			vals[k] = mt.format.scale * dm.e.eval(func(ref exprRef) float64 {
+				target := dm.targets[ref]
+				ts, ok := target.byLabels[l]
+				if !ok {
+					return 0
+				}
+				if ref.report != "" {
+					return values[ts][dm.reportIndex[ref]]
+				}
+				if cumulative {
+					return ts.cumSum * target.format.scale
+				}
+				return ts.iterSum * target.format.scale
+			})
+		}
+		values[ms] = vals
+	}
+}
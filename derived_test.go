@@ -0,0 +1,130 @@
+package olbermann
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseExpr(t *testing.T) {
+	lookup := func(ref exprRef) float64 {
+		switch ref {
+		case exprRef{"Hits", ""}:
+			return 3
+		case exprRef{"Misses", ""}:
+			return 1
+		case exprRef{"Disk.Reads", ""}:
+			return 8
+		case exprRef{"Latency", "w99"}:
+			return 0.5
+		}
+		t.Error("unexpected reference", ref)
+		return 0
+	}
+	for _, c := range []struct {
+		s        string
+		expected float64
+	}{
+		{"Hits/(Hits+Misses)", 0.75},
+		{"100 * Misses / (Hits + Misses)", 25},
+		{"Disk.Reads - Hits * 2", 2},
+		{"-Hits + 1.5", -1.5},
+		{"Latency[w99] * 1000", 500},
+		{"(Hits)", 3},
+		{"1e3 * Hits", 3000},
+		{"Hits * 2.5E-1", 0.75},
+		{"Hits / (Misses - 1)", 0},
+	} {
+		e, _, err := parseExpr(c.s)
+		if err != nil {
+			t.Errorf("unexpected error parsing %q: %v", c.s, err)
+			continue
+		}
+		if v := e.eval(lookup); v != c.expected {
+			t.Errorf("expected %q to evaluate to %v, got %v", c.s, c.expected, v)
+		}
+	}
+	for _, s := range []string{"", "Hits/", "(Hits", "Hits Misses", "Hits[]", "1.2.3", "Hits % 2", "1e", "1e+"} {
+		if _, _, err := parseExpr(s); err == nil {
+			t.Errorf("expected an error parsing %q", s)
+		}
+	}
+}
+
+type CacheMetric struct {
+	Op      string   `label:"op"`
+	Hits    int      `type:"counter" report:"total"`
+	Misses  int      `type:"counter" report:"total"`
+	Latency int      `type:"latency" report:"c50"`
+	HitRate struct{} `derived:"Hits/(Hits+Misses)" report:"iter,cum"`
+	_       struct{} `derived:"Latency[c50] * 2" report:"iter" name:"Double"`
+}
+
+func TestDerived(t *testing.T) {
+	mst, err := newMetricSetTypeOf(CacheMetric{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mst.update(CacheMetric{Op: "get", Hits: 3, Misses: 1, Latency: 5})
+	mst.update(CacheMetric{Op: "put", Hits: 0, Misses: 2, Latency: 7})
+	msv := mst.getValues(time.Second, time.Second)
+	expected := "Hits{op=get} total\nHits{op=put} total\nMisses{op=get} total\nMisses{op=put} total\n" +
+		"Latency{op=get} c50\nLatency{op=put} c50\nHitRate{op=get} iter cum\nHitRate{op=put} iter cum\nDouble{op=get} iter\nDouble{op=put} iter\n"
+	if layout := msv.layout(); layout != expected {
+		t.Fatalf("expected layout %q, got %q", expected, layout)
+	}
+	check := func(metric, report int, expected float64) {
+		if v := msv.metrics[metric].reports[report].value; v != expected {
+			t.Errorf("expected %v for %s %s, got %v", expected, msv.metrics[metric].fullName(), msv.metrics[metric].reports[report].name, v)
+		}
+	}
+	check(6, 0, 0.75)
+	check(6, 1, 0.75)
+	check(7, 0, 0)
+	check(8, 0, 10)
+	check(9, 0, 14)
+
+	mst.update(CacheMetric{Op: "get", Hits: 0, Misses: 4, Latency: 5})
+	msv = mst.getValues(time.Second, time.Second)
+	check(6, 0, 0)
+	check(6, 1, 3.0/8)
+	if v := msv.metrics[7].reports[0].value; v != 0 {
+		t.Error("expected 0 for a hit rate with no hits or misses in the interval, got", v)
+	}
+	// Only metrics referred to without a report need their sums.
+	for _, mt := range mst.metrics[:3] {
+		if summed := mt.name != "Latency"; mt.series[0].summed != summed {
+			t.Errorf("expected %s summed to be %v", mt.name, summed)
+		}
+	}
+}
+
+func TestDerivedValidation(t *testing.T) {
+	type badDerived struct {
+		Hits    int      `type:"counter" report:"total"`
+		Unknown struct{} `derived:"Hits/Nope" report:"iter"`
+		Report  struct{} `derived:"Hits[w99]" report:"cum"`
+		Nested  struct{} `derived:"Unknown" report:"total"`
+		Syntax  struct{} `derived:"Hits +" report:"iter"`
+		_       struct{} `derived:"Hits" report:"iter"`
+	}
+	verr, ok := Validate(badDerived{}).(*ValidationError)
+	if !ok {
+		t.Fatal("expected a *ValidationError")
+	}
+	expected := []string{
+		`Nested report:"total": unknown derived report "total", must be iter or cum`,
+		`Syntax derived:"Hits +": unexpected end of expression`,
+		`_ derived:"Hits": derived metrics on blank fields must have a name`,
+		`Unknown derived:"Hits/Nope": unknown metric "Nope"`,
+		`Report derived:"Hits[w99]": metric "Hits" has no report "w99"`,
+		`Nested derived:"Unknown": cannot refer to derived metric "Unknown"`,
+	}
+	if len(verr.Errors) != len(expected) {
+		t.Fatalf("expected %d errors, got %v", len(expected), verr)
+	}
+	for i := range expected {
+		if s := verr.Errors[i].Error(); s != expected[i] {
+			t.Errorf("expected error %q, got %q", expected[i], s)
+		}
+	}
+}
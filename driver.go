@@ -0,0 +1,174 @@
+package olbermann
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// DriverMetric is the metric struct a Driver sends down its channel, once
+// per operation.  Start a Reporter with a DriverMetric{} sample to report
+// it.
+//
+// Latency is each operation's service time, from when it actually started.
+// In an open loop, IntendedLatency is measured from when the operation was
+// scheduled to start instead, so it includes any time spent waiting for a
+// free worker and isn't fooled by coordinated omission when the system
+// stalls.  In a closed loop the two are the same.
+type DriverMetric struct {
+	Ops             int64   `type:"counter" report:"iter,cum,total"`
+	Errors          int64   `type:"counter" report:"iter,total"`
+	Latency         float64 `type:"latency" report:"w50,w99,c50,c99,c99.9" unit:"ns"`
+	IntendedLatency float64 `type:"latency" report:"w50,w99,c50,c99,c99.9" unit:"ns"`
+}
+
+// An Arrival is the schedule on which an open-loop Driver starts
+// operations.
+type Arrival int
+
+const (
+	// ConstantArrival starts operations evenly spaced at the target rate.
+	ConstantArrival Arrival = iota
+	// PoissonArrival starts operations at random, exponentially
+	// distributed, intervals averaging the target rate.
+	PoissonArrival
+)
+
+// A Driver runs a workload: it calls Op from Concurrency worker
+// goroutines, times each call, and sends a DriverMetric for it down C.
+//
+// With no Rate, the Driver runs closed-loop: each worker calls Op again as
+// soon as the previous call returns.  With a Rate, it runs open-loop:
+// operations are scheduled at that rate (across all workers) according to
+// Arrival, whether or not earlier ones have finished, and wait for a free
+// worker if there is none.
+//
+// Operations that start during the Warmup are run but not recorded.
+//
+// Usage:
+// 	c := make(chan interface{}, 1000)
+// 	r := &olbermann.Reporter{C: c}
+// 	go r.Feed()
+// 	if err := r.Start(olbermann.DriverMetric{}, olbermann.NewBasicDstatStyler()); err != nil {
+// 		return err
+// 	}
+// 	d := &olbermann.Driver{Op: insert, Concurrency: 8, Rate: 5000, Arrival: olbermann.PoissonArrival,
+// 		Warmup: 10 * time.Second, Duration: time.Minute, C: c}
+// 	err := d.Run(context.Background())
+// 	close(c)
+// 	r.Close()
+type Driver struct {
+	Op          func(ctx context.Context) error // The operation to run
+	Concurrency int                             // How many workers call Op, at least 1
+	Rate        float64                         // Target operations per second for an open loop, 0 for a closed loop
+	Arrival     Arrival                         // The open loop's schedule
+	Warmup      time.Duration                   // How long to run before recording anything
+	Duration    time.Duration                   // How long to run after the warmup, 0 to run until the context is done
+	C           chan<- interface{}              // Where to send a DriverMetric for each operation
+}
+
+// Run runs the workload until the warmup and duration have passed, or ctx
+// is done, and waits for the operations in progress to finish.  It returns
+// ctx's error if ctx was done first.
+func (d *Driver) Run(ctx context.Context) error {
+	if d.Op == nil || d.C == nil {
+		return errors.New("olbermann: Driver needs an Op and a C")
+	}
+	if d.Rate < 0 {
+		return errors.New("olbermann: Driver rate must not be negative")
+	}
+	concurrency := d.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	start := time.Now()
+	recordFrom := start.Add(d.Warmup)
+	runCtx := ctx
+	if d.Duration > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithDeadline(ctx, recordFrom.Add(d.Duration))
+		defer cancel()
+	}
+
+	// In an open loop, the scheduler hands intended start times to the
+	// workers, otherwise they start whenever they are free.
+	var schedule chan time.Time
+	if d.Rate > 0 {
+		schedule = make(chan time.Time, concurrency)
+		go d.schedule(runCtx, start, schedule)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				var intended time.Time
+				if schedule != nil {
+					var ok bool
+					if intended, ok = <-schedule; !ok || runCtx.Err() != nil {
+						return
+					}
+				} else if runCtx.Err() != nil {
+					return
+				}
+				// Ops get ctx, so the end of the Duration doesn't cut short
+				// those in progress.
+				d.run(ctx, intended, recordFrom)
+			}
+		}()
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return nil
+}
+
+// run calls Op once, recording it if it was meant to start after
+// recordFrom.  A zero intended start time means now.
+func (d *Driver) run(ctx context.Context, intended time.Time, recordFrom time.Time) {
+	opStart := time.Now()
+	if intended.IsZero() {
+		intended = opStart
+	}
+	err := d.Op(ctx)
+	opEnd := time.Now()
+	if intended.Before(recordFrom) {
+		return
+	}
+	m := DriverMetric{Ops: 1, Latency: float64(opEnd.Sub(opStart)), IntendedLatency: float64(opEnd.Sub(intended))}
+	if err != nil {
+		m.Errors = 1
+	}
+	d.C <- m
+}
+
+// schedule sends the intended start time of each operation down schedule
+// as it comes due, until ctx is done.
+func (d *Driver) schedule(ctx context.Context, start time.Time, schedule chan<- time.Time) {
+	defer close(schedule)
+	next := start
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case schedule <- next:
+		}
+		interval := 1 / d.Rate
+		if d.Arrival == PoissonArrival {
+			interval = rand.ExpFloat64() / d.Rate
+		}
+		next = next.Add(time.Duration(interval * float64(time.Second)))
+		timer.Reset(time.Until(next))
+	}
+}
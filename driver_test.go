@@ -0,0 +1,149 @@
+package olbermann
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// drain collects the DriverMetrics sent down c until it is closed.
+func drain(c <-chan interface{}) (done <-chan DriverMetric) {
+	result := make(chan DriverMetric)
+	go func() {
+		var total DriverMetric
+		for val := range c {
+			m := val.(DriverMetric)
+			total.Ops += m.Ops
+			total.Errors += m.Errors
+			total.Latency += m.Latency
+			total.IntendedLatency += m.IntendedLatency
+		}
+		result <- total
+	}()
+	return result
+}
+
+func TestDriverClosedLoop(t *testing.T) {
+	if err := Validate(DriverMetric{}); err != nil {
+		t.Fatal(err)
+	}
+	c := make(chan interface{}, 100)
+	done := drain(c)
+	var calls int64
+	d := &Driver{
+		Op: func(ctx context.Context) error {
+			if atomic.AddInt64(&calls, 1)%2 == 0 {
+				return errors.New("failed")
+			}
+			time.Sleep(time.Millisecond)
+			return nil
+		},
+		Concurrency: 4,
+		Warmup:      20 * time.Millisecond,
+		Duration:    50 * time.Millisecond,
+		C:           c,
+	}
+	if err := d.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	close(c)
+	total := <-done
+	if total.Ops == 0 || total.Ops >= atomic.LoadInt64(&calls) {
+		t.Errorf("expected some but not all of %d calls to be recorded, got %d", calls, total.Ops)
+	}
+	if total.Errors == 0 || total.Errors >= total.Ops {
+		t.Errorf("expected some of %d ops to be errors, got %d", total.Ops, total.Errors)
+	}
+	if total.Latency <= 0 {
+		t.Error("expected latencies to be recorded")
+	}
+}
+
+func TestDriverOpenLoop(t *testing.T) {
+	for _, arrival := range []Arrival{ConstantArrival, PoissonArrival} {
+		c := make(chan interface{}, 100)
+		done := drain(c)
+		d := &Driver{
+			Op:          func(ctx context.Context) error { return nil },
+			Concurrency: 2,
+			Rate:        1000,
+			Arrival:     arrival,
+			Duration:    200 * time.Millisecond,
+			C:           c,
+		}
+		if err := d.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		close(c)
+		if total := <-done; total.Ops < 100 || total.Ops > 300 {
+			t.Errorf("expected about 200 ops at 1000/s for 200ms with arrival %d, got %d", arrival, total.Ops)
+		}
+	}
+}
+
+func TestDriverCancel(t *testing.T) {
+	c := make(chan interface{}, 100)
+	done := drain(c)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	d := &Driver{Op: func(ctx context.Context) error { return nil }, Rate: 100, C: c}
+	if err := d.Run(ctx); err != context.DeadlineExceeded {
+		t.Error("expected the context's error, got", err)
+	}
+	close(c)
+	<-done
+	if err := (&Driver{C: c}).Run(ctx); err == nil {
+		t.Error("expected an error without an Op")
+	}
+}
+
+func TestDriverIntendedLatency(t *testing.T) {
+	c := make(chan interface{}, 100)
+	done := drain(c)
+	// One worker that takes 10ms per op can't keep up with 500 ops/s, so
+	// ops queue up behind it and their intended latency grows.
+	d := &Driver{
+		Op:       func(ctx context.Context) error { time.Sleep(10 * time.Millisecond); return nil },
+		Rate:     500,
+		Duration: 100 * time.Millisecond,
+		C:        c,
+	}
+	if err := d.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	close(c)
+	total := <-done
+	if total.Ops == 0 || total.IntendedLatency < 2*total.Latency {
+		t.Errorf("expected intended latency well above service time, got %v and %v over %d ops", total.IntendedLatency, total.Latency, total.Ops)
+	}
+}
+
+func TestDriverEndsCleanly(t *testing.T) {
+	c := make(chan interface{}, 1000)
+	done := drain(c)
+	// Ops that honour their context must not fail because the Duration
+	// ended while they were queued or in progress.
+	d := &Driver{
+		Op: func(ctx context.Context) error {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(5 * time.Millisecond):
+				return nil
+			}
+		},
+		Concurrency: 8,
+		Rate:        1000,
+		Duration:    200 * time.Millisecond,
+		C:           c,
+	}
+	if err := d.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	close(c)
+	if total := <-done; total.Ops == 0 || total.Errors != 0 {
+		t.Errorf("expected no errors, got %d out of %d ops", total.Errors, total.Ops)
+	}
+}
@@ -6,20 +6,60 @@ import (
 	"log"
 	"math"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 // DstatStyler is a Styler that produces output similar to dstat.
+//
+// Columns start as wide as their report's name and widen to fit the values
+// printed in them, printing the header again when they do.  Values are
+// humanised: time units are scaled to whichever reads best, and other
+// values get K/M/G/T prefixes.
 type DstatStyler struct {
-	Period              time.Duration // How often to print
-	LinesBetweenHeaders int           // After how many lines to print header info
-	Logger              *log.Logger   // A logger to print to
+	Period              time.Duration              // How often to print
+	LinesBetweenHeaders int                        // After how many lines to print header info
+	Logger              *log.Logger                // A logger to print to
+	TimeFormat          string                     // If set, start each line of values with its time in this layout, for Loggers without timestamps
+	Histograms          int                        // If positive, print a histogram of each latency series every this many intervals, of the values since the last
+	FinalHistograms     bool                       // Print a histogram of each latency series over the whole run at Close
+	Spectrum            bool                       // Print percentile spectra, from p50 to p99.999, instead of histograms
+	Color               bool                       // Colour values by magnitude, when the Logger writes to a terminal
+	widths              map[string]int             // by column
+	pending             map[string]*dstatPending   // by set, for printing histograms
+	latest              map[string]*metricSetValue // by set, for formatting alerts
+	lock                sync.Mutex                 // Held while printing, for Reporters sharing the styler
 }
 
-// A Styler that produces good default output similar to dstat, to
-// standard out, with timestamps, once per second, with headers every 24
-// lines.
+// dstatPending is one set's latency series' values since its last
+// histograms, and how many of its intervals have been printed.
+type dstatPending struct {
+	intervals int
+	series    []*metricValue
+}
+
+// spectrumPercentiles are the percentiles in a spectrum.
+var spectrumPercentiles = []float64{50, 75, 90, 95, 99, 99.9, 99.99, 99.999}
+
+const (
+	histogramBarWidth = 40
+	histogramRows     = 16
+)
+
+// NewBasicDstatStyler returns a Styler that produces good default output
+// similar to dstat, to standard out, with timestamps, once per second,
+// with headers every 24 lines, in colour if standard out is a terminal.
+func NewBasicDstatStyler() *DstatStyler {
+	return &DstatStyler{Period: time.Second, LinesBetweenHeaders: 24, Logger: log.New(os.Stdout, "", log.LstdFlags), Color: true}
+}
+
+// BasicDstatStyler is a shared DstatStyler like NewBasicDstatStyler's, but
+// never in colour, as it always was.
+//
+// Deprecated: Reporters sharing it share its column widths and histograms.
+// Use NewBasicDstatStyler.
 var BasicDstatStyler = DstatStyler{Period: time.Second, LinesBetweenHeaders: 24, Logger: log.New(os.Stdout, "", log.LstdFlags)}
 
 func (s *DstatStyler) period() time.Duration {
@@ -30,54 +70,318 @@ func (s *DstatStyler) linesBetweenHeaders() int {
 	return s.LinesBetweenHeaders
 }
 
-func (s *DstatStyler) printHeader(mst *metricSetType) {
+func (s *DstatStyler) wantsHistograms() bool {
+	return s.Histograms > 0 || s.FinalHistograms
+}
+
+// timePadding is the space to leave before header lines, to line them up
+// with lines of values that start with their time.
+func (s *DstatStyler) timePadding() string {
+	if s.TimeFormat == "" {
+		return ""
+	}
+	return strings.Repeat(" ", len(time.Time{}.Format(s.TimeFormat))+1)
+}
+
+// A dstatCell is one value, formatted to print in its column.
+type dstatCell struct {
+	text      string
+	magnitude int
+	width     int
+}
+
+// dstatMinWidth is the narrowest a column may be.
+const dstatMinWidth = 6
+
+// dstatColors colour values by magnitude: grey for zero, then plain,
+// green, yellow, red and magenta as the values get larger.
+var dstatColors = []string{"\x1b[90m", "", "\x1b[32m", "\x1b[33m", "\x1b[31m", "\x1b[35m"}
+
+// cells formats msv's values for people to read, widening the columns of
+// any that don't fit, and reports whether any did.  Columns are as wide as
+// their report's name and the widest value printed in them so far.
+func (s *DstatStyler) cells(msv *metricSetValue) (cells [][]dstatCell, grew bool) {
+	if s.widths == nil {
+		s.widths = make(map[string]int)
+	}
+	cells = make([][]dstatCell, len(msv.metrics))
+	for i := range msv.metrics {
+		mv := &msv.metrics[i]
+		cells[i] = make([]dstatCell, len(mv.reports))
+		for j := range mv.reports {
+			rv := &mv.reports[j]
+			cell := dstatCell{text: mv.format.human(rv.rt, rv.value), magnitude: mv.format.magnitude(rv.value)}
+			key := mv.fullName() + " " + rv.name
+			width, ok := s.widths[key]
+			if !ok {
+				width = int(math.Max(dstatMinWidth, float64(len(rv.name))))
+			}
+			if len(cell.text) > width {
+				width = len(cell.text)
+				grew = grew || ok
+			}
+			s.widths[key] = width
+			cell.width = width
+			cells[i][j] = cell
+		}
+	}
+	return
+}
+
+// colored reports whether to colour values: if asked to, and the Logger
+// writes to a terminal.
+func (s *DstatStyler) colored() bool {
+	if !s.Color {
+		return false
+	}
+	f, ok := s.Logger.Writer().(*os.File)
+	return ok && isTerminal(f)
+}
+
+func (s *DstatStyler) printHeader(msv *metricSetValue) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.header(msv)
+}
+
+// header prints the header for msv, with the lock held.
+func (s *DstatStyler) header(msv *metricSetValue) {
+	// Tell a Writer that wants to know which lines are headers.
+	if hw, ok := s.Logger.Writer().(headerWriter); ok {
+		var header bytes.Buffer
+		logger := log.New(&header, s.Logger.Prefix(), s.Logger.Flags())
+		s.printHeaderTo(logger, msv)
+		hw.writeHeader(header.Bytes())
+		return
+	}
+	s.printHeaderTo(s.Logger, msv)
+}
+
+// printHeaderTo prints the header lines for msv to logger.
+func (s *DstatStyler) printHeaderTo(logger *log.Logger, msv *metricSetValue) {
+	cells, _ := s.cells(msv)
 	var buf bytes.Buffer
-	for i := range mst.metrics {
-		mt := mst.metrics[i]
+	buf.WriteString(s.timePadding())
+	for i := range msv.metrics {
+		mv := msv.metrics[i]
 		if i > 0 {
 			buf.WriteString("- -")
 		}
-		numSubHeaders := len(mt.reports)
-		colWidth := 12*numSubHeaders + numSubHeaders - 1
-		buf.WriteString(strings.Repeat("-", int(math.Floor(float64(colWidth-len(mt.name)-2)/2))))
-		fmt.Fprintf(&buf, " %s ", strings.ToLower(mt.name))
-		buf.WriteString(strings.Repeat("-", int(math.Ceil(float64(colWidth-len(mt.name)-2)/2))))
+		name := mv.name
+		if !mv.named {
+			name = strings.ToLower(name)
+		}
+		if mv.labels != "" {
+			name += "{" + mv.labels + "}"
+		}
+		colWidth := len(cells[i]) - 1
+		for j := range cells[i] {
+			colWidth += cells[i][j].width
+		}
+		buf.WriteString(strings.Repeat("-", int(math.Max(0, math.Floor(float64(colWidth-len(name)-2)/2)))))
+		fmt.Fprintf(&buf, " %s ", name)
+		buf.WriteString(strings.Repeat("-", int(math.Max(0, math.Ceil(float64(colWidth-len(name)-2)/2)))))
 	}
-	s.Logger.Print(buf.String())
+	logger.Print(buf.String())
 	buf.Reset()
-	for i := range mst.metrics {
-		mt := mst.metrics[i]
+	buf.WriteString(s.timePadding())
+	for i := range msv.metrics {
+		mv := msv.metrics[i]
 		if i > 0 {
 			buf.WriteString(" | ")
 		}
-		for j := range mt.reports {
-			rt := mt.reports[j]
+		for j := range mv.reports {
+			rv := mv.reports[j]
 			if j > 0 {
 				buf.WriteString(" ")
 			}
-			buf.WriteString(strings.Repeat(" ", 12-len(rt.name())))
-			buf.WriteString(rt.name())
+			fmt.Fprintf(&buf, "%*s", cells[i][j].width, rv.name)
 		}
 	}
-	s.Logger.Print(buf.String())
+	logger.Print(buf.String())
 }
 
-func (s *DstatStyler) printValues(curTime time.Time, mst *metricSetType, msv *metricSetValue) {
+func (s *DstatStyler) printValues(curTime time.Time, msv *metricSetValue) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	cells, grew := s.cells(msv)
+	if grew && s.LinesBetweenHeaders >= 0 {
+		s.header(msv)
+	}
+	colored := s.colored()
 	var buf bytes.Buffer
-	for i := range mst.metrics {
-		mt := mst.metrics[i]
-		mv := msv.metrics[i]
+	if s.TimeFormat != "" {
+		buf.WriteString(curTime.Format(s.TimeFormat))
+		buf.WriteString(" ")
+	}
+	for i := range cells {
 		if i > 0 {
 			buf.WriteString(" | ")
 		}
-		for j := range mt.reports {
-			rt := mt.reports[j]
-			rv := mv.reports[j]
+		for j, cell := range cells[i] {
 			if j > 0 {
 				buf.WriteString(" ")
 			}
-			fmt.Fprintf(&buf, "%12s", rt.string(rv.value))
+			if colored && dstatColors[cell.magnitude] != "" {
+				fmt.Fprintf(&buf, "%s%*s%s", dstatColors[cell.magnitude], cell.width, cell.text, ansiReset)
+			} else {
+				fmt.Fprintf(&buf, "%*s", cell.width, cell.text)
+			}
 		}
 	}
 	s.Logger.Print(buf.String())
+	// Values rendered from a Run have no set.
+	var set string
+	if msv.rtype != nil {
+		set = msv.rtype.String()
+		if s.latest == nil {
+			s.latest = make(map[string]*metricSetValue)
+		}
+		s.latest[set] = msv
+	}
+	if s.Histograms > 0 {
+		s.collectHistograms(set, msv)
+	}
+}
+
+// collectHistograms adds msv's latency series to those of its set waiting
+// to be printed, and prints them every Histograms intervals of the set.
+func (s *DstatStyler) collectHistograms(set string, msv *metricSetValue) {
+	if s.pending == nil {
+		s.pending = make(map[string]*dstatPending)
+	}
+	dp := s.pending[set]
+	if dp == nil {
+		dp = &dstatPending{}
+		s.pending[set] = dp
+	}
+	for i := range msv.metrics {
+		mv := &msv.metrics[i]
+		if mv.iterHist == nil {
+			continue
+		}
+		var pending *metricValue
+		for _, p := range dp.series {
+			if p.name == mv.name && p.labels == mv.labels && p.format == mv.format {
+				pending = p
+			}
+		}
+		if pending == nil {
+			pending = &metricValue{name: mv.name, named: mv.named, labels: mv.labels, format: mv.format, reports: mv.reports, iterHist: newHistogram()}
+			dp.series = append(dp.series, pending)
+		}
+		pending.iterHist.merge(mv.iterHist)
+	}
+	if dp.intervals++; dp.intervals%s.Histograms == 0 {
+		for _, p := range dp.series {
+			s.printHistogram(p, p.iterHist, "since the last")
+		}
+		dp.series = nil
+	}
+}
+
+// printHistogram prints h, a histogram of mv's values, or its percentile
+// spectrum.
+func (s *DstatStyler) printHistogram(mv *metricValue, h *histogram, over string) {
+	name := mv.fullName()
+	if !mv.named {
+		name = strings.ToLower(name)
+	}
+	format := func(v float64) string {
+		v *= mv.format.scale
+		if len(mv.reports) > 0 {
+			return mv.format.string(mv.reports[0].rt, v)
+		}
+		return fmt.Sprintf("%g", v)
+	}
+	bar := func(n float64, max float64) string {
+		if max <= 0 {
+			return ""
+		}
+		return strings.Repeat("#", int(math.Ceil(histogramBarWidth*n/max)))
+	}
+	kind := "histogram"
+	if s.Spectrum {
+		kind = "spectrum"
+	}
+	s.Logger.Printf("--- %s %s, %d values %s ---", name, kind, h.total, over)
+	if h.total == 0 {
+		return
+	}
+	if s.Spectrum {
+		for _, p := range spectrumPercentiles {
+			v := h.percentile(p)
+			s.Logger.Printf("%9s %12s |%s", "p"+strconv.FormatFloat(p, 'f', -1, 64), format(v), bar(v, h.max))
+		}
+		s.Logger.Printf("%9s %12s |%s", "max", format(h.max), bar(h.max, h.max))
+		return
+	}
+	// Merge neighbouring buckets until there are few enough rows.
+	buckets := h.buckets()
+	type row struct {
+		low, high float64
+		count     int64
+	}
+	var rows []row
+	if h.zeros > 0 {
+		rows = append(rows, row{0, 0, h.zeros})
+	}
+	if len(buckets) > 0 {
+		first, last := buckets[0], buckets[len(buckets)-1]
+		width := (last - first + histogramRows) / histogramRows
+		for b := first; b <= last; b += width {
+			r := row{low: bucketLow(b), high: bucketLow(b + width)}
+			for k := b; k < b+width; k++ {
+				r.count += h.counts[k]
+			}
+			rows = append(rows, r)
+		}
+	}
+	var most int64
+	for _, r := range rows {
+		if r.count > most {
+			most = r.count
+		}
+	}
+	for _, r := range rows {
+		s.Logger.Printf("%12s - %-12s %10d |%s", format(r.low), format(math.Min(r.high, h.max)), r.count, bar(float64(r.count), float64(most)))
+	}
+}
+
+func (s *DstatStyler) printAlert(ev *AlertEvent) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	line := fmt.Sprintf("!!! ALERT %s: %s is %s", ev.Rule, ev.Metric, ev.value(s.latest[ev.Set]))
+	if s.colored() {
+		line = ansiRed + ansiBold + line + ansiReset
+	}
+	s.Logger.Print(line)
+}
+
+func (s *DstatStyler) printFinal(report *finalReport) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.FinalHistograms {
+		// Only sets with a Styler that wants histograms keep them, and even
+		// a run shorter than an interval has samples in them by now.
+		for _, msv := range report.values {
+			for i := range msv.metrics {
+				if mv := &msv.metrics[i]; mv.cumHist != nil && mv.cumHist.total > 0 {
+					s.printHistogram(mv, mv.cumHist, "over the run")
+				}
+			}
+		}
+	}
+	if len(report.alerts) > 0 {
+		s.Logger.Print("--- alerts ---")
+		for i := range report.alerts {
+			s.Logger.Printf("%s: fired %d times", report.alerts[i].Rule, report.alerts[i].Fired)
+		}
+	}
+	if len(report.assertions) > 0 {
+		s.Logger.Print("--- assertions ---")
+		for i := range report.assertions {
+			s.Logger.Print(report.assertions[i].String())
+		}
+	}
 }
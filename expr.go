@@ -0,0 +1,218 @@
+package olbermann
+
+import (
+	"errors"
+	"strconv"
+)
+
+// An exprRef is a reference to another metric in a derived expression.
+// Without a report, it stands for the sum of the metric's values (over the
+// interval or the whole run, depending on the derived report), with one it
+// stands for that report's value, as in "Latency[w99]".
+type exprRef struct {
+	metric string
+	report string
+}
+
+// An expr is a parsed arithmetic expression over references to metrics.
+type expr interface {
+	eval(lookup func(ref exprRef) float64) float64
+}
+
+type numberExpr float64
+
+func (e numberExpr) eval(lookup func(ref exprRef) float64) float64 {
+	return float64(e)
+}
+
+type refExpr exprRef
+
+func (e refExpr) eval(lookup func(ref exprRef) float64) float64 {
+	return lookup(exprRef(e))
+}
+
+type negExpr struct {
+	x expr
+}
+
+func (e negExpr) eval(lookup func(ref exprRef) float64) float64 {
+	return -e.x.eval(lookup)
+}
+
+type binaryExpr struct {
+	op   byte
+	x, y expr
+}
+
+func (e binaryExpr) eval(lookup func(ref exprRef) float64) float64 {
+	x, y := e.x.eval(lookup), e.y.eval(lookup)
+	switch e.op {
+	case '+':
+		return x + y
+	case '-':
+		return x - y
+	case '*':
+		return x * y
+	}
+	// An idle interval shouldn't turn a ratio into NaN or Inf, which
+	// neither alerts nor JSON can make sense of.
+	if y == 0 {
+		return 0
+	}
+	return x / y
+}
+
+// exprParser is a recursive descent parser for expressions made of numbers,
+// metric references, parentheses, and the operators + - * and /.  Numbers
+// may have an exponent, as in "1e3".
+type exprParser struct {
+	s    string
+	pos  int
+	refs []exprRef
+}
+
+// parseExpr parses s, returning the expression and every metric it
+// references.
+func parseExpr(s string) (e expr, refs []exprRef, err error) {
+	p := &exprParser{s: s}
+	if e, err = p.parseSum(); err != nil {
+		return
+	}
+	if p.skipSpace(); p.pos < len(p.s) {
+		err = errors.New("unexpected " + strconv.Quote(p.s[p.pos:]))
+		return
+	}
+	refs = p.refs
+	return
+}
+
+func (p *exprParser) skipSpace() {
+	for p.pos < len(p.s) && p.s[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+// peek returns the next non-space character, or 0 at the end.
+func (p *exprParser) peek() byte {
+	if p.skipSpace(); p.pos < len(p.s) {
+		return p.s[p.pos]
+	}
+	return 0
+}
+
+func (p *exprParser) parseSum() (e expr, err error) {
+	if e, err = p.parseProduct(); err != nil {
+		return
+	}
+	for op := p.peek(); op == '+' || op == '-'; op = p.peek() {
+		p.pos++
+		var y expr
+		if y, err = p.parseProduct(); err != nil {
+			return
+		}
+		e = binaryExpr{op, e, y}
+	}
+	return
+}
+
+func (p *exprParser) parseProduct() (e expr, err error) {
+	if e, err = p.parseUnary(); err != nil {
+		return
+	}
+	for op := p.peek(); op == '*' || op == '/'; op = p.peek() {
+		p.pos++
+		var y expr
+		if y, err = p.parseUnary(); err != nil {
+			return
+		}
+		e = binaryExpr{op, e, y}
+	}
+	return
+}
+
+func (p *exprParser) parseUnary() (e expr, err error) {
+	if p.peek() == '-' {
+		p.pos++
+		if e, err = p.parseUnary(); err != nil {
+			return
+		}
+		e = negExpr{e}
+		return
+	}
+	return p.parseTerm()
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || c == '.' || isDigit(c)
+}
+
+func (p *exprParser) parseTerm() (e expr, err error) {
+	c := p.peek()
+	switch {
+	case c == '(':
+		p.pos++
+		if e, err = p.parseSum(); err != nil {
+			return
+		}
+		if p.peek() != ')' {
+			err = errors.New("missing )")
+			return
+		}
+		p.pos++
+	case isDigit(c) || c == '.':
+		start := p.pos
+		for p.pos < len(p.s) && (isDigit(p.s[p.pos]) || p.s[p.pos] == '.') {
+			p.pos++
+		}
+		if exp := p.pos + 1; exp < len(p.s) && (p.s[p.pos] == 'e' || p.s[p.pos] == 'E') {
+			if exp+1 < len(p.s) && (p.s[exp] == '+' || p.s[exp] == '-') {
+				exp++
+			}
+			if isDigit(p.s[exp]) {
+				p.pos = exp
+				for p.pos < len(p.s) && isDigit(p.s[p.pos]) {
+					p.pos++
+				}
+			}
+		}
+		var f float64
+		if f, err = strconv.ParseFloat(p.s[start:p.pos], 64); err != nil {
+			err = errors.New("invalid number " + strconv.Quote(p.s[start:p.pos]))
+			return
+		}
+		e = numberExpr(f)
+	case isIdentStart(c):
+		start := p.pos
+		for p.pos < len(p.s) && isIdentPart(p.s[p.pos]) {
+			p.pos++
+		}
+		ref := exprRef{metric: p.s[start:p.pos]}
+		if p.pos < len(p.s) && p.s[p.pos] == '[' {
+			end := p.pos + 1
+			for end < len(p.s) && p.s[end] != ']' {
+				end++
+			}
+			if end == len(p.s) || end == p.pos+1 {
+				err = errors.New("invalid report reference after " + ref.metric)
+				return
+			}
+			ref.report = p.s[p.pos+1 : end]
+			p.pos = end + 1
+		}
+		p.refs = append(p.refs, ref)
+		e = refExpr(ref)
+	case c == 0:
+		err = errors.New("unexpected end of expression")
+	default:
+		err = errors.New("unexpected " + strconv.Quote(string(c)))
+	}
+	return
+}
@@ -0,0 +1,223 @@
+package olbermann
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// A valueFormat describes how a metric's values are presented, according
+// to its "unit", "scale" and "format" tags.
+//
+// The scale is a multiplier applied to every reported value, the format is
+// a printf verb such as "%.3f" or "%d", and the unit names what the scaled
+// values measure.  Time units ("ns", "us", "ms" and "s") are humanised to
+// whichever of them reads best, any other unit gets a K/M/G/T prefix.
+// Stylers meant for machines print scaled values with the format, but do
+// not humanise them.
+type valueFormat struct {
+	unit   string
+	scale  float64
+	format string
+}
+
+var timeUnits = []struct {
+	unit    string
+	seconds float64
+}{
+	{"s", 1},
+	{"ms", 1e-3},
+	{"us", 1e-6},
+	{"ns", 1e-9},
+}
+
+var siPrefixes = []struct {
+	prefix string
+	value  float64
+}{
+	{"T", 1e12},
+	{"G", 1e9},
+	{"M", 1e6},
+	{"K", 1e3},
+}
+
+func newValueFormat(field reflect.StructField, errs *fieldErrors) (f *valueFormat) {
+	f = &valueFormat{unit: field.Tag.Get("unit"), scale: 1, format: field.Tag.Get("format")}
+	if scale := field.Tag.Get("scale"); scale != "" {
+		var err error
+		if f.scale, err = strconv.ParseFloat(scale, 64); err != nil || f.scale <= 0 || math.IsInf(f.scale, 0) {
+			errs.add(field, "scale", "must be a positive number")
+			f.scale = 1
+		}
+	}
+	if f.format != "" && !isValidFormat(f.format) {
+		errs.add(field, "format", "must be a single printf verb for a number, such as %.3f or %d")
+		f.format = ""
+	}
+	return
+}
+
+// isValidFormat reports whether format formats exactly one number.
+func isValidFormat(format string) bool {
+	if strings.Count(format, "%")-2*strings.Count(format, "%%") != 1 {
+		return false
+	}
+	var s string
+	if isIntegerVerb(format) {
+		s = fmt.Sprintf(format, int64(1))
+	} else {
+		s = fmt.Sprintf(format, 1.0)
+	}
+	return !strings.Contains(s, "%!")
+}
+
+// verbOf returns the first printf verb in format, or 0 if there is none.
+func verbOf(format string) byte {
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		if i+1 < len(format) && format[i+1] == '%' {
+			i++
+			continue
+		}
+		for i++; i < len(format); i++ {
+			if c := format[i]; c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' {
+				return c
+			}
+		}
+	}
+	return 0
+}
+
+// isIntegerVerb reports whether format expects an integer argument.
+func isIntegerVerb(format string) bool {
+	verb := verbOf(format)
+	return verb != 0 && strings.IndexByte("dxXob", verb) >= 0
+}
+
+func (f *valueFormat) sprintf(format string, val float64) string {
+	if isIntegerVerb(format) {
+		return fmt.Sprintf(format, int64(math.Round(val)))
+	}
+	return fmt.Sprintf(format, val)
+}
+
+// plain formats val with the format tag, or with the given default.
+func (f *valueFormat) plain(val float64, def string) string {
+	if f.format != "" {
+		return f.sprintf(f.format, val)
+	}
+	return f.sprintf(def, val)
+}
+
+// string formats val for people to read, humanising it according to the
+// unit if there is one.
+func (f *valueFormat) string(rt reportType, val float64) string {
+	if f.unit == "" {
+		if f.format != "" {
+			return f.sprintf(f.format, val)
+		}
+		return rt.string(val)
+	}
+	suffix := ""
+	if _, ok := rt.(rateReport); ok {
+		suffix = "/s"
+	}
+	scaled := func(val float64, unit string) string {
+		format := f.format
+		if format == "" || isIntegerVerb(format) {
+			format = "%.2f"
+		}
+		return f.sprintf(format, val) + unit + suffix
+	}
+	for i := range timeUnits {
+		if timeUnits[i].unit != f.unit {
+			continue
+		}
+		seconds := val * timeUnits[i].seconds
+		for j := range timeUnits {
+			if math.Abs(seconds) >= timeUnits[j].seconds {
+				return scaled(seconds/timeUnits[j].seconds, timeUnits[j].unit)
+			}
+		}
+		return scaled(val, f.unit)
+	}
+	for i := range siPrefixes {
+		if math.Abs(val) >= siPrefixes[i].value {
+			return scaled(val/siPrefixes[i].value, siPrefixes[i].prefix+f.unit)
+		}
+	}
+	if f.format != "" {
+		return f.sprintf(f.format, val) + f.unit + suffix
+	}
+	return rt.string(val) + f.unit + suffix
+}
+
+// human formats val like string, but also puts K/M/G/T prefixes on values
+// without a unit or format, to three significant figures, as in "340K".
+func (f *valueFormat) human(rt reportType, val float64) string {
+	if f.unit != "" || f.format != "" || math.Abs(val) < 1e3 {
+		return f.string(rt, val)
+	}
+	suffix := ""
+	if _, ok := rt.(rateReport); ok {
+		suffix = "/s"
+	}
+	for i := range siPrefixes {
+		if math.Abs(val) >= siPrefixes[i].value {
+			val /= siPrefixes[i].value
+			format := "%.2f"
+			if math.Abs(val) >= 100 {
+				format = "%.0f"
+			} else if math.Abs(val) >= 10 {
+				format = "%.1f"
+			}
+			return fmt.Sprintf(format, val) + siPrefixes[i].prefix + suffix
+		}
+	}
+	return f.string(rt, val)
+}
+
+// tagged formats val as string does if the metric has a unit or format
+// tag, or with plain if it has neither, for summaries and axes, whose
+// values needn't look like the report's own.
+func (f *valueFormat) tagged(rt reportType, val float64, plain func(float64) string) string {
+	if f.unit == "" && f.format == "" || math.IsNaN(val) {
+		return plain(val)
+	}
+	return f.string(rt, val)
+}
+
+// magnitude ranks how large val is, for colouring it: 0 for zero, then 1
+// for nanoseconds or plain values, 2 for microseconds or K, and so on.
+func (f *valueFormat) magnitude(val float64) int {
+	if val == 0 || math.IsNaN(val) {
+		return 0
+	}
+	for i := range timeUnits {
+		if timeUnits[i].unit != f.unit {
+			continue
+		}
+		seconds := math.Abs(val) * timeUnits[i].seconds
+		for j := range timeUnits {
+			if seconds >= timeUnits[j].seconds {
+				return len(timeUnits) - j
+			}
+		}
+		return 1
+	}
+	for i := range siPrefixes {
+		if math.Abs(val) >= siPrefixes[i].value {
+			return len(siPrefixes) - i + 1
+		}
+	}
+	return 1
+}
+
+// rateReport is implemented by reports whose values are per-second rates.
+type rateReport interface {
+	perSecond()
+}
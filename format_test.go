@@ -0,0 +1,172 @@
+package olbermann
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type FormattedMetric struct {
+	Tps     int     `type:"counter" report:"iter,total" name:"tps"`
+	Bytes   int     `type:"counter" report:"iter,total" unit:"B"`
+	Latency float64 `type:"latency" report:"c50" unit:"ms" scale:"1e-6"`
+	Ratio   float64 `type:"counter" report:"total" format:"%.4f"`
+}
+
+func TestFormatTags(t *testing.T) {
+	mst, err := newMetricSetTypeOf(FormattedMetric{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mst.update(FormattedMetric{Tps: 3, Bytes: 1500000, Latency: 250000, Ratio: 0.25})
+	msv := mst.getValues(time.Second, time.Second)
+	expected := "tps iter total\nBytes iter total\nLatency c50\nRatio total\n"
+	if layout := msv.layout(); layout != expected {
+		t.Errorf("expected layout %q, got %q", expected, layout)
+	}
+	if !msv.metrics[0].named || msv.metrics[1].named {
+		t.Error("expected only tps to be named")
+	}
+	if v := msv.metrics[2].reports[0].value; v != 0.25 {
+		t.Error("expected scaled latency 0.25, got", v)
+	}
+	for _, c := range []struct {
+		metric, report int
+		expected       string
+	}{
+		{0, 0, "3.00"},
+		{0, 1, "3"},
+		{1, 0, "1.50MB/s"},
+		{1, 1, "1.50MB"},
+		{2, 0, "250.00us"},
+		{3, 0, "0.2500"},
+	} {
+		mv := &msv.metrics[c.metric]
+		if s := mv.string(&mv.reports[c.report]); s != c.expected {
+			t.Errorf("expected %s %s to format as %q, got %q", mv.name, mv.reports[c.report].name, c.expected, s)
+		}
+	}
+	if s := msv.metrics[3].format.plain(0.25, "%f"); s != "0.2500" {
+		t.Errorf("expected plain ratio 0.2500, got %q", s)
+	}
+	if s := msv.metrics[2].format.plain(0.25, "%f"); s != "0.250000" {
+		t.Errorf("expected plain latency 0.250000, got %q", s)
+	}
+}
+
+func TestFormatHumanise(t *testing.T) {
+	total := new(totalCounterReportType)
+	rate := new(iterCounterReportType)
+	for _, c := range []struct {
+		f        valueFormat
+		rt       reportType
+		val      float64
+		expected string
+	}{
+		{valueFormat{unit: "ns", scale: 1}, total, 1500, "1.50us"},
+		{valueFormat{unit: "ns", scale: 1}, total, 2.5e9, "2.50s"},
+		{valueFormat{unit: "s", scale: 1}, total, 0.002, "2.00ms"},
+		{valueFormat{unit: "ms", scale: 1}, total, 0, "0.00ms"},
+		{valueFormat{unit: "ops", scale: 1}, rate, 340000, "340.00Kops/s"},
+		{valueFormat{unit: "ops", scale: 1, format: "%.1f"}, rate, 1.2e6, "1.2Mops/s"},
+		{valueFormat{unit: "ops", scale: 1}, total, 12, "12ops"},
+		{valueFormat{scale: 1, format: "%d"}, rate, 12.6, "13"},
+	} {
+		if s := c.f.string(c.rt, c.val); s != c.expected {
+			t.Errorf("expected %v to format as %q with %+v, got %q", c.val, c.expected, c.f, s)
+		}
+	}
+}
+
+func TestFormatHumanCounts(t *testing.T) {
+	total := new(totalCounterReportType)
+	rate := new(iterCounterReportType)
+	for _, c := range []struct {
+		f         valueFormat
+		rt        reportType
+		val       float64
+		expected  string
+		magnitude int
+	}{
+		{valueFormat{scale: 1}, total, 0, "0", 0},
+		{valueFormat{scale: 1}, total, 999, "999", 1},
+		{valueFormat{scale: 1}, total, 340000, "340K", 2},
+		{valueFormat{scale: 1}, total, 1.2e6, "1.20M", 3},
+		{valueFormat{scale: 1}, rate, 45600, "45.6K/s", 2},
+		{valueFormat{scale: 1}, total, 7.5e12, "7.50T", 5},
+		{valueFormat{unit: "B", scale: 1}, total, 1500000, "1.50MB", 3},
+		{valueFormat{unit: "ns", scale: 1}, total, 0, "0.00ns", 0},
+		{valueFormat{unit: "ns", scale: 1}, total, 500, "500.00ns", 1},
+		{valueFormat{unit: "ns", scale: 1}, total, 2.5e6, "2.50ms", 3},
+		{valueFormat{unit: "ms", scale: 1}, total, 1500, "1.50s", 4},
+		{valueFormat{scale: 1, format: "%.1f"}, total, 1.2e6, "1200000.0", 3},
+	} {
+		if s := c.f.human(c.rt, c.val); s != c.expected {
+			t.Errorf("expected %v to humanise as %q with %+v, got %q", c.val, c.expected, c.f, s)
+		}
+		if m := c.f.magnitude(c.val); m != c.magnitude {
+			t.Errorf("expected %v to have magnitude %d with %+v, got %d", c.val, c.magnitude, c.f, m)
+		}
+	}
+}
+
+type widthMetric struct {
+	Ops int `type:"counter" report:"total" format:"%.0f"`
+}
+
+func TestDstatColumns(t *testing.T) {
+	var buf bytes.Buffer
+	s := &DstatStyler{Logger: log.New(&buf, "", 0), LinesBetweenHeaders: 100, Color: true}
+	r := &Reporter{}
+	tr := startTestRun(t, r, widthMetric{}, s)
+	for _, n := range []int{5, 1234567, 3} {
+		tr.interval(widthMetric{Ops: n})
+	}
+	r.Close()
+	expected := []string{
+		" ops -",
+		" total",
+		"     5",
+		"- ops -",
+		"  total",
+		"1234572",
+		"1234575",
+	}
+	out := buf.String()
+	if strings.Contains(out, "\x1b") {
+		t.Errorf("expected no colour when not writing to a terminal, got %q", out)
+	}
+	if lines := strings.Split(strings.TrimRight(out, "\n"), "\n"); strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected\n%s\ngot\n%s", strings.Join(expected, "\n"), out)
+	}
+}
+
+func TestDstatShared(t *testing.T) {
+	var buf bytes.Buffer
+	s := &DstatStyler{Logger: log.New(&buf, "", 0), LinesBetweenHeaders: 2, Histograms: 1}
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		tr := startTestRun(t, &Reporter{}, latencyValueSet{}, s)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 1; j <= 20; j++ {
+				tr.interval(latencyValueSet{Latency: float64(j)})
+			}
+			tr.r.Close()
+		}()
+	}
+	wg.Wait()
+}
+
+func TestBasicDstatStylerColor(t *testing.T) {
+	if BasicDstatStyler.Color {
+		t.Error("expected the deprecated BasicDstatStyler to stay uncoloured")
+	}
+	if !NewBasicDstatStyler().Color {
+		t.Error("expected NewBasicDstatStyler to colour a terminal")
+	}
+}
@@ -0,0 +1,125 @@
+package olbermann
+
+import (
+	"math"
+	"sort"
+)
+
+// histogramGrowth is how much wider each of a histogram's buckets is than
+// the last, and so how close its percentiles are to the truth.
+var histogramGrowth = math.Pow(2, 1.0/8)
+
+var logHistogramGrowth = math.Log(histogramGrowth)
+
+// A histogram counts a latency metric's values in logarithmic buckets, to
+// show the shape of their distribution rather than a few percentiles.
+type histogram struct {
+	counts map[int]int64 // By bucket
+	zeros  int64         // Values of zero or less
+	total  int64
+	max    float64
+}
+
+func newHistogram() *histogram {
+	return &histogram{counts: make(map[int]int64)}
+}
+
+// bucketOf is the bucket v falls in, holding values from
+// histogramGrowth^bucket up to histogramGrowth^(bucket+1).
+func bucketOf(v float64) int {
+	return int(math.Floor(math.Log(v) / logHistogramGrowth))
+}
+
+// bucketLow is the lowest value in bucket.
+func bucketLow(bucket int) float64 {
+	return math.Pow(histogramGrowth, float64(bucket))
+}
+
+func (h *histogram) insert(v float64) {
+	if math.IsNaN(v) {
+		return
+	}
+	h.total++
+	h.max = math.Max(h.max, v)
+	if v <= 0 {
+		h.zeros++
+		return
+	}
+	h.counts[bucketOf(v)]++
+}
+
+func (h *histogram) reset() {
+	h.counts = make(map[int]int64)
+	h.zeros, h.total, h.max = 0, 0, 0
+}
+
+func (h *histogram) clone() (c *histogram) {
+	c = newHistogram()
+	c.merge(h)
+	return
+}
+
+// merge adds o's values to h.
+func (h *histogram) merge(o *histogram) {
+	for b, n := range o.counts {
+		h.counts[b] += n
+	}
+	h.zeros += o.zeros
+	h.total += o.total
+	h.max = math.Max(h.max, o.max)
+}
+
+// buckets returns the buckets with values in them, in order.
+func (h *histogram) buckets() (buckets []int) {
+	for b := range h.counts {
+		buckets = append(buckets, b)
+	}
+	sort.Ints(buckets)
+	return
+}
+
+// percentile estimates the pth percentile, as the middle of the bucket
+// it falls in, but never more than the largest value.  The 100th
+// percentile is the largest value.
+func (h *histogram) percentile(p float64) float64 {
+	if h.total == 0 {
+		return math.NaN()
+	}
+	rank := int64(math.Ceil(p / 100 * float64(h.total)))
+	if rank >= h.total {
+		return h.max
+	}
+	seen := h.zeros
+	if rank <= seen {
+		return 0
+	}
+	for _, b := range h.buckets() {
+		if seen += h.counts[b]; seen >= rank {
+			return math.Min(h.max, math.Sqrt(bucketLow(b)*bucketLow(b+1)))
+		}
+	}
+	return h.max
+}
+
+// histogramStyler is implemented by Stylers that may print histograms.
+// Latency series only keep histograms for metric sets started with one
+// that wants them, since keeping them slows down every value added.
+type histogramStyler interface {
+	wantsHistograms() bool
+}
+
+// keepHistograms has the set's latency series keep histograms of their
+// values from now on.
+func (mst *metricSetType) keepHistograms() {
+	mst.lock.Lock()
+	defer mst.lock.Unlock()
+	for _, mt := range mst.metrics {
+		if !mt.latency || mt.histograms {
+			continue
+		}
+		mt.histograms = true
+		for _, ms := range mt.series {
+			ms.iterHist, ms.cumHist = newHistogram(), newHistogram()
+		}
+	}
+}
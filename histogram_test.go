@@ -0,0 +1,130 @@
+package olbermann
+
+import (
+	"bytes"
+	"log"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistogramPercentiles(t *testing.T) {
+	h := newHistogram()
+	for i := 1; i <= 1000; i++ {
+		h.insert(float64(i))
+	}
+	h.insert(0)
+	for _, p := range []float64{50, 90, 99, 99.9} {
+		expected := p / 100 * 1001
+		if v := h.percentile(p); math.Abs(v-expected)/expected > histogramGrowth-1 {
+			t.Errorf("expected p%v within a bucket of %v, got %v", p, expected, v)
+		}
+	}
+	if v := h.percentile(100); v != 1000 {
+		t.Error("expected p100 to be the largest value, got", v)
+	}
+	if v := h.percentile(0.01); v != 0 {
+		t.Error("expected the lowest percentile to be 0, got", v)
+	}
+	c := h.clone()
+	h.reset()
+	if c.total != 1001 || h.total != 0 || !math.IsNaN(h.percentile(50)) {
+		t.Error("expected clones to be independent")
+	}
+}
+
+type histogramMetric struct {
+	Latency float64 `type:"latency" report:"w99" unit:"ms"`
+}
+
+type otherHistogramMetric struct {
+	Latency float64 `type:"latency" report:"w99" unit:"ms"`
+}
+
+func TestDstatHistograms(t *testing.T) {
+	var buf bytes.Buffer
+	s := &DstatStyler{Logger: log.New(&buf, "", 0), Histograms: 2, FinalHistograms: true}
+	r := &Reporter{}
+	tr := startTestRun(t, r, histogramMetric{}, s)
+	// A bimodal distribution: mostly 1ms, with a bump at 100ms.
+	for i := 1; i <= 4; i++ {
+		for j := 0; j < 90; j++ {
+			tr.mst.update(histogramMetric{Latency: 1})
+		}
+		for j := 0; j < 10; j++ {
+			tr.mst.update(histogramMetric{Latency: 100})
+		}
+		tr.interval()
+	}
+	r.Close()
+	out := buf.String()
+	if n := strings.Count(out, "--- latency histogram, 200 values since the last ---"); n != 2 {
+		t.Errorf("expected a histogram every 2 intervals, got %d in\n%s", n, out)
+	}
+	if !strings.Contains(out, "--- latency histogram, 400 values over the run ---") {
+		t.Errorf("expected a histogram of the whole run at Close, got\n%s", out)
+	}
+	// Two sets printing to one styler count their own intervals.
+	buf.Reset()
+	s = &DstatStyler{Logger: log.New(&buf, "", 0), Histograms: 2}
+	r = &Reporter{}
+	tr = startTestRun(t, r, histogramMetric{}, s)
+	if err := r.Start(otherHistogramMetric{}, s); err != nil {
+		t.Fatal(err)
+	}
+	tr.interval(histogramMetric{Latency: 1})
+	r.Close()
+	if n := strings.Count(buf.String(), "--- latency histogram"); n != 0 {
+		t.Errorf("expected no histograms after one interval of each set, got %d in\n%s", n, buf.String())
+	}
+	lines := strings.Split(out, "\n")
+	var bars []int
+	for _, line := range lines {
+		if i := strings.Index(line, "|"); i >= 0 && strings.Contains(line, " - ") {
+			bars = append(bars, len(line)-i-1)
+		}
+	}
+	if len(bars) < 3 || bars[0] != histogramBarWidth || bars[len(bars)-1] == 0 || bars[1] != 0 {
+		t.Errorf("expected two separate bumps, got bars %v in\n%s", bars, out)
+	}
+
+	buf.Reset()
+	s = &DstatStyler{Logger: log.New(&buf, "", 0), FinalHistograms: true, Spectrum: true}
+	r = &Reporter{}
+	startTestRun(t, r, histogramMetric{}, s).interval(histogramMetric{Latency: 1})
+	r.Close()
+	if out := buf.String(); !strings.Contains(out, "--- latency spectrum, 1 values over the run ---") || !strings.Contains(out, "p99.999") {
+		t.Errorf("expected a spectrum at Close, got\n%s", out)
+	}
+
+	// A run shorter than an interval still gets its histogram.
+	buf.Reset()
+	s = &DstatStyler{Logger: log.New(&buf, "", 0), FinalHistograms: true}
+	r = &Reporter{}
+	tr = startTestRun(t, r, histogramMetric{}, s)
+	tr.mst.update(histogramMetric{Latency: 1})
+	tr.mst.update(histogramMetric{Latency: 2})
+	r.Close()
+	if out := buf.String(); !strings.Contains(out, "--- latency histogram, 2 values over the run ---") {
+		t.Errorf("expected a histogram at Close without any intervals, got\n%s", out)
+	}
+}
+
+func TestHistogramsOnlyWhenWanted(t *testing.T) {
+	r := &Reporter{}
+	mst := startTestRun(t, r, histogramMetric{}, &DstatStyler{Logger: log.New(&bytes.Buffer{}, "", 0)}).mst
+	mst.update(histogramMetric{Latency: 1})
+	if msv := mst.tick(time.Now()); msv.metrics[0].iterHist != nil {
+		t.Error("expected no histograms when no Styler prints them")
+	}
+	// Histograms are kept from when a Styler that wants them starts.
+	if err := r.Start(histogramMetric{}, &DstatStyler{Logger: log.New(&bytes.Buffer{}, "", 0), FinalHistograms: true}); err != nil {
+		t.Fatal(err)
+	}
+	mst.update(histogramMetric{Latency: 1})
+	if msv := mst.tick(time.Now()); msv.metrics[0].iterHist == nil || msv.metrics[0].iterHist.total != 1 {
+		t.Error("expected histograms once a Styler prints them")
+	}
+	r.Close()
+}
@@ -0,0 +1,247 @@
+package olbermann
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"os"
+	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// HTMLStyler is a Styler that collects every interval's values and, when
+// the Reporter is closed, writes a report of the run to Writer as a single
+// HTML page: its configuration, a summary of every metric, charts like
+// ChartStyler's, any alerts and assertions, and the definitions of the
+// metric structs.  The page needs nothing else to display, so it can be
+// attached to a ticket as it is.
+//
+// The host's name and the command line are only recorded if Environment is
+// set, since command lines often carry passwords or connection strings.
+type HTMLStyler struct {
+	Period      time.Duration     // How often to collect values
+	Writer      io.Writer         // A writer to write the page to
+	Title       string            // The page's title, "olbermann report" if empty
+	Config      map[string]string // Anything else about the run worth recording, such as its settings
+	Environment bool              // Record the host's name and the full command line
+	Err         error             // Any error from writing the page
+	run         Run
+	types       []reflect.Type
+}
+
+func (s *HTMLStyler) period() time.Duration {
+	return s.Period
+}
+
+func (s *HTMLStyler) linesBetweenHeaders() int {
+	return -1
+}
+
+func (s *HTMLStyler) err() error {
+	return s.Err
+}
+
+func (s *HTMLStyler) printHeader(msv *metricSetValue) {}
+
+func (s *HTMLStyler) printValues(curTime time.Time, msv *metricSetValue) {
+	s.run.appendValues(msv)
+	for i := range s.types {
+		if s.types[i] == msv.rtype {
+			return
+		}
+	}
+	s.types = append(s.types, msv.rtype)
+}
+
+type htmlSetting struct {
+	Name  string
+	Value string
+}
+
+// An htmlSummary is a ColumnSummary with its values formatted like the
+// column's metric, and its value at Close.
+type htmlSummary struct {
+	Column string
+	N      int
+	Min    string
+	Mean   string
+	Max    string
+	Stddev string
+	Final  string
+}
+
+type htmlPage struct {
+	Title       string
+	Config      []htmlSetting
+	Summary     []htmlSummary
+	Chart       template.HTML
+	Alerts      []AlertCount
+	Assertions  []AssertionResult
+	Definitions []string
+}
+
+func (s *HTMLStyler) printFinal(report *finalReport) {
+	page := htmlPage{Title: s.Title, Alerts: report.alerts, Assertions: report.assertions}
+	if page.Title == "" {
+		page.Title = "olbermann report"
+	}
+
+	if len(s.run.Times) > 0 {
+		start, end := s.run.Times[0], report.snapshot.Time
+		page.Config = append(page.Config,
+			htmlSetting{"started", start.Format(time.RFC3339)},
+			htmlSetting{"finished", end.Format(time.RFC3339)},
+			htmlSetting{"elapsed", report.snapshot.Elapsed.String()})
+	}
+	page.Config = append(page.Config,
+		htmlSetting{"interval", (time.Duration(*outputSecondsInterval) * time.Second).String()},
+		htmlSetting{"go", runtime.Version()})
+	if s.Environment {
+		host, _ := os.Hostname()
+		page.Config = append(page.Config,
+			htmlSetting{"command", strings.Join(os.Args, " ")},
+			htmlSetting{"host", host})
+	}
+	var names []string
+	for name := range s.Config {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		page.Config = append(page.Config, htmlSetting{name, s.Config[name]})
+	}
+
+	// Metrics of the same name in different sets have different values.
+	type setColumn struct {
+		set    string
+		column string
+	}
+	final := make(map[setColumn]float64)
+	for _, m := range report.snapshot.Metrics {
+		for _, rs := range m.Reports {
+			final[setColumn{m.Set, m.FullName() + " " + rs.Name}] = rs.Value
+		}
+	}
+	for j, cs := range s.run.Summarize() {
+		set := s.run.columnSets[j].String()
+		num := func(val float64) string {
+			return s.run.formatValue(j, val, formatNumber)
+		}
+		hs := htmlSummary{Column: cs.Column, N: cs.N, Min: num(cs.Min), Mean: num(cs.Mean), Max: num(cs.Max), Stddev: num(cs.Stddev)}
+		if v, ok := final[setColumn{set, strings.TrimPrefix(cs.Column, set+" ")}]; ok {
+			hs.Final = num(v)
+		}
+		page.Summary = append(page.Summary, hs)
+	}
+
+	var chart bytes.Buffer
+	if s.Err = s.run.WriteSVG(&chart); s.Err != nil {
+		return
+	}
+	page.Chart = template.HTML(chart.String())
+	for i := range s.types {
+		page.Definitions = append(page.Definitions, structDefinition(s.types[i]))
+	}
+	s.Err = htmlTemplate.Execute(s.Writer, &page)
+}
+
+// structDefinition writes rtype out as Go source, followed by the struct
+// types from the same package nested in it.
+func structDefinition(rtype reflect.Type) string {
+	var buf bytes.Buffer
+	seen := make(map[reflect.Type]bool)
+	types := []reflect.Type{rtype}
+	for len(types) > 0 {
+		t := types[0]
+		types = types[1:]
+		if seen[t] {
+			continue
+		}
+		seen[t] = true
+		if buf.Len() > 0 {
+			buf.WriteString("\n")
+		}
+		fmt.Fprintf(&buf, "type %s struct {\n", t.Name())
+		tw := tabwriter.NewWriter(&buf, 0, 8, 1, ' ', 0)
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.Anonymous {
+				fmt.Fprintf(tw, "\t%s", field.Type)
+			} else {
+				fmt.Fprintf(tw, "\t%s\t%s", field.Name, field.Type)
+			}
+			if field.Tag != "" {
+				fmt.Fprintf(tw, "\t`%s`", field.Tag)
+			}
+			fmt.Fprintln(tw)
+			ft := field.Type
+			for ft.Kind() == reflect.Ptr || ft.Kind() == reflect.Map || ft.Kind() == reflect.Slice {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct && ft.Name() != "" && ft.PkgPath() == rtype.PkgPath() {
+				types = append(types, ft)
+			}
+		}
+		tw.Flush()
+		buf.WriteString("}\n")
+	}
+	return buf.String()
+}
+
+// formatNumber formats a number for a table.
+func formatNumber(val float64) string {
+	if math.IsNaN(val) {
+		return ""
+	}
+	return strconv.FormatFloat(val, 'g', 6, 64)
+}
+
+var htmlTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { padding: 0.2em 0.8em; border-bottom: 1px solid #ddd; text-align: left; }
+td.num { text-align: right; font-family: monospace; }
+.pass { color: #2ca02c; }
+.fail { color: #d62728; font-weight: bold; }
+pre { background: #f6f6f6; padding: 1em; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<h2>Configuration</h2>
+<table>
+{{range .Config}}<tr><th>{{.Name}}</th><td>{{.Value}}</td></tr>
+{{end}}</table>
+<h2>Summary</h2>
+<table>
+<tr><th>metric</th><th>n</th><th>min</th><th>mean</th><th>max</th><th>stddev</th><th>final</th></tr>
+{{range .Summary}}<tr><td>{{.Column}}</td><td class="num">{{.N}}</td><td class="num">{{.Min}}</td><td class="num">{{.Mean}}</td><td class="num">{{.Max}}</td><td class="num">{{.Stddev}}</td><td class="num">{{.Final}}</td></tr>
+{{end}}</table>
+<h2>Charts</h2>
+{{.Chart}}
+{{if .Alerts}}<h2>Alerts</h2>
+<table>
+<tr><th>rule</th><th>fired</th></tr>
+{{range .Alerts}}<tr><td>{{.Rule}}</td><td class="num">{{.Fired}}</td></tr>
+{{end}}</table>
+{{end}}{{if .Assertions}}<h2>Assertions</h2>
+<table>
+{{range .Assertions}}<tr><td class="{{if .Passed}}pass{{else}}fail{{end}}">{{.String}}</td></tr>
+{{end}}</table>
+{{end}}<h2>Metrics</h2>
+{{range .Definitions}}<pre>{{.}}</pre>
+{{end}}</body>
+</html>
+`))
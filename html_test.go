@@ -0,0 +1,108 @@
+package olbermann
+
+import (
+	"bytes"
+	"html/template"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestHTMLStyler(t *testing.T) {
+	type diskMetric struct {
+		Reads int64 `type:"counter" report:"iter"`
+	}
+	type htmlMetric struct {
+		Op      string  `label:"op"`
+		Ops     int64   `type:"counter" report:"iter,total"`
+		Latency float64 `type:"latency" report:"c50" unit:"ms"`
+		Disk    diskMetric
+	}
+	var buf bytes.Buffer
+	s := &HTMLStyler{Writer: &buf, Title: "nightly <insert>", Config: map[string]string{"engine": "lsm"}}
+	r := &Reporter{}
+	tr := startTestRun(t, r, htmlMetric{}, s)
+	// Started for another metric set too, it still writes one page.
+	if err := r.Start(diskMetric{}, s); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Assert("Ops total >= 100"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 3; i++ {
+		tr.interval(htmlMetric{Op: "get", Ops: 10, Latency: 5})
+	}
+	r.Close()
+	if results := r.AssertionResults(); len(results) != 1 || results[0].Passed {
+		t.Error("expected the assertion to fail, got", results)
+	}
+	if s.Err != nil {
+		t.Fatal(s.Err)
+	}
+	page := buf.String()
+	for _, expected := range []string{
+		"<title>nightly &lt;insert&gt;</title>",
+		"<th>engine</th><td>lsm</td>",
+		`<td>olbermann.htmlMetric Ops{op=get} iter</td><td class="num">3</td>`,
+		// Values are formatted with their units, in the summary and on the
+		// chart's axes.
+		`<td>olbermann.htmlMetric Latency{op=get} c50</td><td class="num">3</td><td class="num">5.00ms</td>`,
+		">5.00ms</text>",
+		"<svg ",
+		`class="fail">FAIL`,
+		"type htmlMetric struct {",
+		"type diskMetric struct {",
+		"Ops     int64",
+	} {
+		if !strings.Contains(page, expected) {
+			t.Errorf("expected the page to contain %q, got\n%s", expected, page)
+		}
+	}
+	if n := strings.Count(page, "<!DOCTYPE html>"); n != 1 {
+		t.Errorf("expected one page, got %d", n)
+	}
+	if strings.Contains(page, "<script") || strings.Contains(page, "<link") {
+		t.Error("expected a page that loads nothing else")
+	}
+	if strings.Contains(page, "<th>command</th>") || strings.Contains(page, "<th>host</th>") {
+		t.Error("expected no command line or host unless asked for")
+	}
+
+	buf.Reset()
+	r = &Reporter{}
+	startTestRun(t, r, diskMetric{}, &HTMLStyler{Writer: &buf, Environment: true}).interval()
+	r.Close()
+	if page := buf.String(); !strings.Contains(page, "<th>command</th><td>"+template.HTMLEscapeString(os.Args[0])) || !strings.Contains(page, "<th>host</th>") {
+		t.Errorf("expected the command line and host when asked for, got\n%s", page)
+	}
+}
+
+func TestHTMLStylerSameNames(t *testing.T) {
+	type readMetric struct {
+		Ops int64 `type:"counter" report:"total"`
+	}
+	type writeMetric struct {
+		Ops int64 `type:"counter" report:"total"`
+	}
+	var buf bytes.Buffer
+	s := &HTMLStyler{Writer: &buf}
+	r := &Reporter{}
+	tr := startTestRun(t, r, readMetric{}, s)
+	tr.interval(readMetric{Ops: 1})
+	if err := r.Start(writeMetric{}, s); err != nil {
+		t.Fatal(err)
+	}
+	writes, _ := r.metricSetFor(writeMetric{})
+	writes.update(writeMetric{Ops: 100})
+	tr.interval(readMetric{Ops: 2})
+	r.Close()
+	page := buf.String()
+	for _, expected := range []string{
+		`<td>olbermann.readMetric Ops total</td><td class="num">2</td><td class="num">1</td><td class="num">2</td><td class="num">3</td><td class="num">1.41421</td><td class="num">3</td>`,
+		`<td>olbermann.writeMetric Ops total</td><td class="num">1</td><td class="num">100</td><td class="num">100</td><td class="num">100</td><td class="num"></td><td class="num">100</td>`,
+	} {
+		if !strings.Contains(page, expected) {
+			t.Errorf("expected the page to contain %q, got\n%s", expected, page)
+		}
+	}
+}
@@ -1,7 +1,6 @@
 package olbermann
 
 import (
-	"errors"
 	"fmt"
 	"github.com/bmizerany/perks/quantile"
 	"reflect"
@@ -10,14 +9,31 @@ import (
 	"time"
 )
 
+// insertCorrected inserts v into strm.  If expected is positive, it also
+// back-fills the samples that coordinated omission kept from being taken,
+// the way HdrHistogram's RecordValueWithExpectedInterval does: a value
+// larger than the expected interval between samples stands in for samples
+// of v-expected, v-2*expected, and so on down to expected, which were
+// never taken while the system stalled.
+func insertCorrected(strm *quantile.Stream, v float64, expected float64) {
+	strm.Insert(v)
+	if expected <= 0 {
+		return
+	}
+	for missing := v - expected; missing >= expected; missing -= expected {
+		strm.Insert(missing)
+	}
+}
+
 type windowLatencyReportType struct {
 	nameString string
 	strm *quantile.Stream
 	quant float64
+	expected float64
 }
 
-func newWindowLatencyReportType(name string, quant float64) (res *windowLatencyReportType) {
-	res = &windowLatencyReportType{nameString: name, strm: quantile.NewTargeted(quant), quant: quant}
+func newWindowLatencyReportType(name string, quant float64, expected float64) (res *windowLatencyReportType) {
+	res = &windowLatencyReportType{nameString: name, strm: quantile.NewTargeted(quant), quant: quant, expected: expected}
 	return
 }
 
@@ -26,15 +42,18 @@ func (t *windowLatencyReportType) name() string {
 }
 
 func (t *windowLatencyReportType) add(fval reflect.Value) {
-	t.strm.Insert(toFloat(fval))
+	insertCorrected(t.strm, toFloat(fval), t.expected)
 }
 
 func (t *windowLatencyReportType) get(iterDuration time.Duration, cumDuration time.Duration) (res float64) {
 	res = t.strm.Query(t.quant)
-	t.strm.Reset()
 	return
 }
 
+func (t *windowLatencyReportType) roll() {
+	t.strm.Reset()
+}
+
 func (t *windowLatencyReportType) string(val float64) string {
 	return fmt.Sprintf("%.2f", val)
 }
@@ -45,10 +64,11 @@ type cumulativeLatencyReportType struct {
 	nameString string
 	strm *quantile.Stream
 	quant float64
+	expected float64
 }
 
-func newCumulativeLatencyReportType(name string, quant float64) (res *cumulativeLatencyReportType) {
-	res = &cumulativeLatencyReportType{nameString: name, strm: quantile.NewTargeted(quant), quant: quant}
+func newCumulativeLatencyReportType(name string, quant float64, expected float64) (res *cumulativeLatencyReportType) {
+	res = &cumulativeLatencyReportType{nameString: name, strm: quantile.NewTargeted(quant), quant: quant, expected: expected}
 	return
 }
 
@@ -57,7 +77,7 @@ func (t *cumulativeLatencyReportType) name() string {
 }
 
 func (t *cumulativeLatencyReportType) add(fval reflect.Value) {
-	t.strm.Insert(toFloat(fval))
+	insertCorrected(t.strm, toFloat(fval), t.expected)
 }
 
 func (t *cumulativeLatencyReportType) get(iterDuration time.Duration, cumDuration time.Duration) (res float64) {
@@ -65,32 +85,77 @@ func (t *cumulativeLatencyReportType) get(iterDuration time.Duration, cumDuratio
 	return
 }
 
+func (t *cumulativeLatencyReportType) roll() {}
+
 func (t *cumulativeLatencyReportType) string(val float64) string {
 	return fmt.Sprintf("%.2f", val)
 }
 
 func (t *cumulativeLatencyReportType) close() {}
 
-func newLatencyMetric(field reflect.StructField) (metric metricType, err error) {
-	reportNames := strings.Split(field.Tag.Get("report"), ",")
-	if len(reportNames) < 1 {
-		err = errors.New("latency metric " + field.Name + " must define reports")
+// expectedInterval parses a latency metric's "expected" tag, the interval
+// expected between samples, into the field's raw (unscaled) units.
+func expectedInterval(field reflect.StructField, errs *fieldErrors) (expected float64) {
+	tag := field.Tag.Get("expected")
+	if tag == "" {
 		return
 	}
-	reports := make([]reportType, len(reportNames))
+	threshold, unit, err := parseThreshold(tag)
+	c := Condition{Threshold: threshold, Unit: unit}
+	if err == nil {
+		expected, err = c.thresholdIn(field.Tag.Get("unit"))
+	}
+	if err != nil || expected <= 0 {
+		errs.add(field, "expected", "must be a positive interval, in the metric's unit")
+		return 0
+	}
+	if scale, err := strconv.ParseFloat(field.Tag.Get("scale"), 64); err == nil && scale > 0 {
+		expected /= scale
+	}
+	return
+}
+
+// A latency metric reports percentiles over each interval ("w99") or the
+// whole run ("c99").  With an "expected" tag, reports ending in "co"
+// ("w99co", "c99co") are corrected for coordinated omission.
+func newLatencyMetric(field reflect.StructField, errs *fieldErrors) (metric *metricType) {
+	reportNames := splitReportNames(field, errs)
+	expected := expectedInterval(field, errs)
+	percentiles := make([]float64, len(reportNames))
+	corrected := make([]bool, len(reportNames))
 	for i := range reportNames {
-		var percentile float64
-		if percentile, err = strconv.ParseFloat(reportNames[i][1:], 64); err != nil {
-			return
+		name := reportNames[i]
+		if corrected[i] = strings.HasSuffix(name, "co"); corrected[i] {
+			name = strings.TrimSuffix(name, "co")
+			if field.Tag.Get("expected") == "" {
+				errs.add(field, "report", "corrected latency report "+strconv.Quote(reportNames[i])+" needs an expected tag")
+			}
+		}
+		if len(name) < 2 || (name[0] != 'w' && name[0] != 'c') {
+			errs.add(field, "report", "unknown latency report "+strconv.Quote(reportNames[i])+", must be w or c followed by a percentile")
+			continue
 		}
-		switch reportNames[i][:1] {
-		case "w":
-			reports[i] = newWindowLatencyReportType(reportNames[i], percentile*0.01)
-		case "c":
-			reports[i] = newCumulativeLatencyReportType(reportNames[i], percentile*0.01)
+		var err error
+		if percentiles[i], err = strconv.ParseFloat(name[1:], 64); err != nil || percentiles[i] <= 0 || percentiles[i] > 100 {
+			errs.add(field, "report", "invalid percentile in latency report "+strconv.Quote(reportNames[i])+", must be in (0, 100]")
+		}
+	}
+	newReports := func() []reportType {
+		reports := make([]reportType, len(reportNames))
+		for i := range reportNames {
+			var reportExpected float64
+			if corrected[i] {
+				reportExpected = expected
+			}
+			switch reportNames[i][:1] {
+			case "w":
+				reports[i] = newWindowLatencyReportType(reportNames[i], percentiles[i]*0.01, reportExpected)
+			case "c":
+				reports[i] = newCumulativeLatencyReportType(reportNames[i], percentiles[i]*0.01, reportExpected)
+			}
 		}
+		return reports
 	}
-	metric.name = field.Name
-	metric.reports = reports
+	metric = &metricType{name: field.Name, reportNames: reportNames, newReports: newReports, latency: true}
 	return
 }
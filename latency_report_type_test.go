@@ -0,0 +1,63 @@
+package olbermann
+
+import (
+	"testing"
+	"time"
+)
+
+type correctedMetric struct {
+	Latency float64 `type:"latency" report:"c50,c50co,w100,w100co" unit:"ms" expected:"10ms"`
+	Scaled  int64   `type:"latency" report:"c50co" unit:"ms" scale:"1e-6" expected:"10ms"`
+}
+
+func TestCoordinatedOmission(t *testing.T) {
+	mst, err := newMetricSetTypeOf(correctedMetric{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Nine quick samples, then a stall of 1s in which 99 samples should
+	// have been taken but weren't.
+	for i := 0; i < 9; i++ {
+		mst.update(correctedMetric{Latency: 1, Scaled: 1e6})
+	}
+	mst.update(correctedMetric{Latency: 1000, Scaled: 1000e6})
+	msv := mst.getValues(time.Second, time.Second)
+	check := func(metric, report int, expected float64) {
+		if v := msv.metrics[metric].reports[report].value; v != expected {
+			t.Errorf("expected %v for %s %s, got %v", expected, msv.metrics[metric].name, msv.metrics[metric].reports[report].name, v)
+		}
+	}
+	check(0, 0, 1)
+	check(0, 2, 1000)
+	check(0, 3, 1000)
+	for _, v := range []float64{msv.metrics[0].reports[1].value, msv.metrics[1].reports[0].value} {
+		if v < 100 {
+			t.Error("expected the corrected median to be pulled up by the back-filled samples, got", v)
+		}
+	}
+}
+
+func TestCoordinatedOmissionValidation(t *testing.T) {
+	type badCorrected struct {
+		NoExpected float64 `type:"latency" report:"c99co"`
+		BadUnit    float64 `type:"latency" report:"c99co" unit:"B" expected:"10ms"`
+		Negative   float64 `type:"latency" report:"c99co" expected:"-1"`
+	}
+	verr, ok := Validate(badCorrected{}).(*ValidationError)
+	if !ok {
+		t.Fatal("expected a *ValidationError")
+	}
+	expected := []string{
+		`NoExpected report:"c99co": corrected latency report "c99co" needs an expected tag`,
+		`BadUnit expected:"10ms": must be a positive interval, in the metric's unit`,
+		`Negative expected:"-1": must be a positive interval, in the metric's unit`,
+	}
+	if len(verr.Errors) != len(expected) {
+		t.Fatalf("expected %d errors, got %v", len(expected), verr)
+	}
+	for i := range expected {
+		if s := verr.Errors[i].Error(); s != expected[i] {
+			t.Errorf("expected error %q, got %q", expected[i], s)
+		}
+	}
+}
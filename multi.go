@@ -0,0 +1,313 @@
+package olbermann
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// A DropPolicy says what a MultiStyler does with an interval when a sink's
+// queue is full.
+type DropPolicy int
+
+const (
+	DropOldest DropPolicy = iota // Drop the oldest waiting interval to make room, so the sink catches up
+	DropNewest                   // Drop the new interval, so the sink prints a gapless prefix
+	Block                        // Wait for room, holding up the Reporter and every other sink
+)
+
+// ErrDropped is passed to a MultiStyler's OnError when a sink falls so far
+// behind that an interval is dropped.
+var ErrDropped = errors.New("olbermann: sink fell behind, dropped an interval")
+
+// ErrFinalTimeout is passed to a MultiStyler's OnError when a sink hasn't
+// printed its final report within FinalTimeout.
+var ErrFinalTimeout = errors.New("olbermann: sink timed out printing its final report")
+
+// A Sink is one of a MultiStyler's Stylers, with its own queue.
+type Sink struct {
+	Styler Styler     // Where to send values
+	Queue  int        // How many intervals may wait for the Styler, 16 if 0
+	Drop   DropPolicy // What to do with intervals when the queue is full
+}
+
+// MultiStyler is a Styler that sends every interval's values to several
+// Stylers at once, such as the screen, a CSV file and a network endpoint.
+// Each Sink prints from its own goroutine and queue, so one that is slow
+// or stuck only falls behind, and drops intervals as its Drop says, rather
+// than holding up the Reporter and the others.
+//
+// Errors are passed to OnError: the errors Stylers that write files keep in
+// Err, any panic in a Styler, and ErrDropped for each dropped interval.
+// Each sink's headers are printed as if it had been started on its own.
+// Once the final report has been printed at Close, the MultiStyler prints
+// nothing more.
+//
+// Usage:
+// 	out := &olbermann.RotatingFile{Path: "soak.csv", MaxSize: 64 << 20, Compress: olbermann.Gzip}
+// 	defer out.Close()
+// 	ms := &olbermann.MultiStyler{
+// 		Sinks: []olbermann.Sink{
+// 			{Styler: olbermann.NewBasicDstatStyler()},
+// 			{Styler: &olbermann.CsvStyler{Writer: out}, Drop: olbermann.Block},
+// 		},
+// 		OnError: func(s olbermann.Styler, err error) { log.Printf("%T: %v", s, err) },
+// 	}
+// 	if err := r.Start(ReportableMetric{}, ms); err != nil {
+// 		return err
+// 	}
+type MultiStyler struct {
+	Period       time.Duration                  // How often to print
+	Sinks        []Sink                         // Where to send values
+	OnError      func(styler Styler, err error) // Called with each error, if set, from any goroutine
+	FinalTimeout time.Duration                  // How long to wait for the sinks' final reports at Close, 10s if 0, forever if negative
+	once         sync.Once
+	final        sync.Once
+	sinks        []*sink
+}
+
+// sinkQueue is how many intervals a Sink's Styler may fall behind by
+// default.
+const sinkQueue = 16
+
+// finalTimeout is how long Close waits for the sinks by default.
+const finalTimeout = 10 * time.Second
+
+// A sink is a running Sink.
+type sink struct {
+	Sink
+	subs    map[reflect.Type]*subscription // By metric set, only used by the sink's goroutine
+	queue   chan func()                    // Ended by a nil func
+	done    chan bool
+	closed  chan bool // Closed when printFinal starts, so nothing more is queued
+	abandon chan bool // Closed when printFinal stops waiting for the sink
+	lastErr error
+	onError func(styler Styler, err error)
+}
+
+// erring is implemented by Stylers that keep the first error they hit.
+type erring interface {
+	err() error
+}
+
+func (s *MultiStyler) init() {
+	s.once.Do(func() {
+		for i := range s.Sinks {
+			sk := &sink{Sink: s.Sinks[i], subs: make(map[reflect.Type]*subscription), done: make(chan bool), closed: make(chan bool), abandon: make(chan bool), onError: s.OnError}
+			if sk.Queue <= 0 {
+				sk.Queue = sinkQueue
+			}
+			sk.queue = make(chan func(), sk.Queue)
+			s.sinks = append(s.sinks, sk)
+			go sk.run()
+		}
+	})
+}
+
+// run prints what's queued for the sink until the queue ends, or until
+// printFinal gives up on it.
+func (sk *sink) run() {
+	defer close(sk.done)
+	for {
+		select {
+		case f := <-sk.queue:
+			if f == nil {
+				return
+			}
+			sk.call(f)
+		case <-sk.abandon:
+			return
+		}
+	}
+}
+
+// call calls f, reporting any panic or new error from the Styler.
+func (sk *sink) call(f func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			sk.report(fmt.Errorf("olbermann: %T panicked: %v", sk.Styler, r))
+		}
+	}()
+	f()
+	if e, ok := sk.Styler.(erring); ok {
+		if err := e.err(); err != nil && err != sk.lastErr {
+			sk.lastErr = err
+			sk.report(err)
+		}
+	}
+}
+
+func (sk *sink) report(err error) {
+	if sk.onError != nil {
+		sk.onError(sk.Styler, err)
+	}
+}
+
+// send queues f for the sink, dropping an interval by the sink's policy
+// if the queue is full.  Once printFinal has started, f is dropped.
+func (sk *sink) send(f func()) {
+	select {
+	case <-sk.closed:
+		return
+	default:
+	}
+	if sk.Drop == Block {
+		select {
+		case sk.queue <- f:
+		case <-sk.closed:
+		}
+		return
+	}
+	select {
+	case sk.queue <- f:
+		return
+	default:
+	}
+	if sk.Drop == DropNewest {
+		sk.report(ErrDropped)
+		return
+	}
+	for {
+		select {
+		case sk.queue <- f:
+			return
+		case <-sk.queue:
+			sk.report(ErrDropped)
+		case <-sk.closed:
+			return
+		}
+	}
+}
+
+func (s *MultiStyler) period() time.Duration {
+	return s.Period
+}
+
+// linesBetweenHeaders is -1, since each sink prints its own headers.
+func (s *MultiStyler) linesBetweenHeaders() int {
+	return -1
+}
+
+func (s *MultiStyler) printHeader(msv *metricSetValue) {}
+
+// check checks every sink's settings.
+func (s *MultiStyler) check() error {
+	for i := range s.Sinks {
+		if c, ok := s.Sinks[i].Styler.(checker); ok {
+			if err := c.check(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *MultiStyler) claim(rtype reflect.Type) error {
+	for i := range s.Sinks {
+		if c, ok := s.Sinks[i].Styler.(setClaimer); ok {
+			if err := c.claim(rtype); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *MultiStyler) wantsHistograms() bool {
+	for i := range s.Sinks {
+		if hs, ok := s.Sinks[i].Styler.(histogramStyler); ok && hs.wantsHistograms() {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *MultiStyler) printValues(curTime time.Time, msv *metricSetValue) {
+	s.init()
+	for _, sk := range s.sinks {
+		sk := sk
+		sk.send(func() {
+			sub := sk.subs[msv.rtype]
+			if sub == nil {
+				sub = &subscription{styler: sk.Styler}
+				sk.subs[msv.rtype] = sub
+			}
+			sub.print(msv)
+		})
+	}
+}
+
+func (s *MultiStyler) printAlert(ev *AlertEvent) {
+	s.init()
+	for _, sk := range s.sinks {
+		if ap, ok := sk.Styler.(alertPrinter); ok {
+			sk.send(func() { ap.printAlert(ev) })
+		}
+	}
+}
+
+// printFinal hands every sink the final report, never dropping it, and
+// waits for them to finish, or for FinalTimeout.  It only does so once.
+func (s *MultiStyler) printFinal(report *finalReport) {
+	s.init()
+	s.final.Do(func() { s.finish(report) })
+}
+
+func (s *MultiStyler) finish(report *finalReport) {
+	for _, sk := range s.sinks {
+		close(sk.closed)
+	}
+	// Release the sinks' goroutines, and those queueing for them, if we
+	// stop waiting.
+	defer func() {
+		for _, sk := range s.sinks {
+			close(sk.abandon)
+		}
+	}()
+	var timeout <-chan time.Time
+	if s.FinalTimeout >= 0 {
+		d := s.FinalTimeout
+		if d == 0 {
+			d = finalTimeout
+		}
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	for _, sk := range s.sinks {
+		sk := sk
+		fp, ok := sk.Styler.(finalPrinter)
+		go func() {
+			if ok {
+				select {
+				case sk.queue <- func() { fp.printFinal(report) }:
+				case <-sk.abandon:
+					return
+				}
+			}
+			select {
+			case sk.queue <- nil:
+			case <-sk.abandon:
+			}
+		}()
+	}
+	timedOut := false
+	for _, sk := range s.sinks {
+		if timedOut {
+			select {
+			case <-sk.done:
+			default:
+				sk.report(ErrFinalTimeout)
+			}
+			continue
+		}
+		select {
+		case <-sk.done:
+		case <-timeout:
+			timedOut = true
+			sk.report(ErrFinalTimeout)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package olbermann
+
+import (
+	"bytes"
+	"errors"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stuckStyler is a Styler that blocks until released, like one writing to
+// a network endpoint that is down.
+type stuckStyler struct {
+	release chan bool
+	lock    sync.Mutex
+	printed int
+}
+
+func (s *stuckStyler) period() time.Duration           { return 0 }
+func (s *stuckStyler) linesBetweenHeaders() int        { return -1 }
+func (s *stuckStyler) printHeader(msv *metricSetValue) {}
+
+func (s *stuckStyler) printValues(curTime time.Time, msv *metricSetValue) {
+	<-s.release
+	s.lock.Lock()
+	s.printed++
+	s.lock.Unlock()
+}
+
+func (s *stuckStyler) printFinal(report *finalReport) {}
+
+// panickyStyler is a Styler that panics every time it prints.
+type panickyStyler struct{}
+
+func (s panickyStyler) period() time.Duration                              { return 0 }
+func (s panickyStyler) linesBetweenHeaders() int                           { return -1 }
+func (s panickyStyler) printHeader(msv *metricSetValue)                    {}
+func (s panickyStyler) printValues(curTime time.Time, msv *metricSetValue) { panic("oops") }
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("endpoint down")
+}
+
+func TestMultiStyler(t *testing.T) {
+	var buf bytes.Buffer
+	stuck := &stuckStyler{release: make(chan bool)}
+	var lock sync.Mutex
+	errs := make(map[string]int)
+	ms := &MultiStyler{
+		Sinks: []Sink{
+			{Styler: &CsvStyler{Writer: &buf}, Drop: Block},
+			{Styler: stuck, Queue: 2},
+			{Styler: panickyStyler{}},
+			{Styler: &CsvStyler{Writer: failingWriter{}}},
+		},
+		OnError: func(s Styler, err error) {
+			lock.Lock()
+			errs[err.Error()]++
+			lock.Unlock()
+		},
+	}
+	r := &Reporter{}
+	tr := startTestRun(t, r, csvMetric{}, ms)
+	done := make(chan bool)
+	go func() {
+		for i := 1; i <= 10; i++ {
+			tr.interval(csvMetric{Ops: 1})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a stuck sink not to hold up the Reporter")
+	}
+	close(stuck.release)
+	r.Close()
+
+	if lines := strings.Count(buf.String(), "\n"); lines != 11 {
+		t.Errorf("expected a header and 10 lines in the CSV, got\n%s", buf.String())
+	}
+	if stuck.printed > 3 {
+		t.Errorf("expected the stuck sink to drop intervals, but it printed %d", stuck.printed)
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if errs[ErrDropped.Error()] != 10-stuck.printed {
+		t.Errorf("expected %d dropped intervals, got errors %v", 10-stuck.printed, errs)
+	}
+	if errs["olbermann: olbermann.panickyStyler panicked: oops"] != 10 {
+		t.Error("expected every panic to be reported, got", errs)
+	}
+	if errs["endpoint down"] != 1 {
+		t.Error("expected a write error to be reported once, got", errs)
+	}
+}
+
+func TestMultiStylerFinalTimeout(t *testing.T) {
+	goroutines := runtime.NumGoroutine()
+	stuck := &stuckStyler{release: make(chan bool)}
+	var timedOut []Styler
+	ms := &MultiStyler{
+		// With a full queue, even the final report has to wait.
+		Sinks:        []Sink{{Styler: stuck, Queue: 1, Drop: DropNewest}, {Styler: &CsvStyler{Writer: &bytes.Buffer{}}}},
+		FinalTimeout: 200 * time.Millisecond,
+		OnError: func(s Styler, err error) {
+			if err == ErrFinalTimeout {
+				timedOut = append(timedOut, s)
+			}
+		},
+	}
+	r := &Reporter{}
+	tr := startTestRun(t, r, csvMetric{}, ms)
+	tr.interval()
+	// Let the stuck sink take the first interval, so the second fills its
+	// queue.
+	time.Sleep(20 * time.Millisecond)
+	tr.interval()
+	closed := make(chan bool)
+	go func() {
+		r.Close()
+		close(closed)
+	}()
+	// While Close waits for the stuck sink, the Reporter isn't locked.
+	time.Sleep(20 * time.Millisecond)
+	snapshotted := make(chan bool)
+	go func() {
+		r.Snapshot()
+		close(snapshotted)
+	}()
+	select {
+	case <-snapshotted:
+	case <-closed:
+		t.Error("expected Close to wait for the stuck sink")
+	}
+	<-closed
+	if len(timedOut) != 1 || timedOut[0] != stuck {
+		t.Error("expected only the stuck sink to time out, got", timedOut)
+	}
+	// Only the stuck sink's own goroutine is left, and it goes too once the
+	// sink gets going again.
+	waitForGoroutines(t, goroutines+1)
+	close(stuck.release)
+	waitForGoroutines(t, goroutines)
+}
+
+// waitForGoroutines waits a while for there to be at most n goroutines.
+func waitForGoroutines(t *testing.T, n int) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); runtime.NumGoroutine() > n; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected at most %d goroutines, got %d", n, runtime.NumGoroutine())
+		}
+	}
+}
+
+func TestMultiStylerAfterClose(t *testing.T) {
+	var buf bytes.Buffer
+	ms := &MultiStyler{Sinks: []Sink{{Styler: &CsvStyler{Writer: &buf}, Drop: Block}, {Styler: &CsvStyler{Writer: &bytes.Buffer{}}}}}
+	r := &Reporter{}
+	tr := startTestRun(t, r, csvMetric{}, ms)
+	tr.interval(csvMetric{Ops: 1})
+	r.Close()
+	printed := buf.String()
+
+	// Printing again drops the values, rather than panicking or blocking.
+	ms.printValues(time.Now(), tr.mst.getValues(time.Second, time.Second))
+	ms.printAlert(&AlertEvent{})
+	ms.printFinal(&finalReport{})
+	if buf.String() != printed {
+		t.Errorf("expected nothing more to be printed after Close, got\n%s", buf.String())
+	}
+}
@@ -12,6 +12,80 @@
 // 	}
 //
 // Then just send ReportableMetric objects or pointers down a channel, olbermann will take care of the rest.
+//
+// To break metrics down by some dimension, such as operation type or shard, add a field tagged with "label".
+// Every distinct label value gets its own series of the struct's other metrics:
+//
+// 	type OpMetric struct {
+// 		Op      string  `label:"op"`
+// 		Latency float64 `type:"latency" report:"w99,c99"`
+// 	}
+//
+// Map-valued metric fields fan out the same way, one series per map key, named by the field's "label" tag if it has one:
+//
+// 	type ShardMetric struct {
+// 		Inserts map[int]int64 `type:"counter" report:"iter" label:"shard"`
+// 	}
+//
+// Series are reported as they are discovered, so headers are printed again when a new label value shows up.
+//
+// Metrics may be grouped into nested structs, which are reported with dotted names (e.g. "Disk.Reads"), and embedded structs, whose metrics are promoted as if declared directly.
+// Fields without a "type" or "label" tag are ignored, as are unexported fields and fields tagged `olbermann:"-"`:
+//
+// 	type DiskMetric struct {
+// 		Reads  int64 `type:"counter" report:"iter"`
+// 		Writes int64 `type:"counter" report:"iter"`
+// 	}
+//
+// 	type ServerMetric struct {
+// 		BaseMetric            // embedded: fields reported as-is
+// 		Disk       DiskMetric // nested: Disk.Reads, Disk.Writes
+// 		Debug      int64      `type:"counter" report:"total" olbermann:"-"` // skipped
+// 		Host       string     // untagged: ignored
+// 		started    time.Time  // unexported: ignored
+// 	}
+//
+// Optional tags control how a metric is presented, by every Styler:
+//
+//  - name:   the name to report instead of the field's name
+//  - scale:  a multiplier applied to every reported value, e.g. "1e-6" to report nanoseconds as milliseconds
+//  - format: a printf verb for values, e.g. "%.3f" or "%d"
+//  - unit:   what the (scaled) values measure; DstatStyler humanises time units (ns, us, ms, s) and puts K/M/G/T prefixes on others
+//
+// An "alert" tag declares threshold rules on the metric's reports, separated by semicolons, such as `alert:"w99>50ms for 3; c99>20ms"`.
+// See Reporter.Alert.
+//
+// 	type TimedMetric struct {
+// 		Transactions int64   `type:"counter" report:"iter,cum" name:"tps"`
+// 		Written      int64   `type:"counter" report:"iter" unit:"B"`
+// 		Latency      float64 `type:"latency" report:"w99" unit:"ms" scale:"1e-6" format:"%.1f"`
+// 	}
+//
+// Latency metrics sampled at a fixed rate can be corrected for coordinated omission: when the measured system stalls, the samples that should have been taken during the stall never are, and the percentiles look better than they were.
+// Give the metric an "expected" tag with the interval expected between samples, in the metric's unit or with a time unit, and ask for reports ending in "co".
+// Every sample longer than the expected interval then stands in for the samples that were missed while it ran:
+//
+// 	type RequestMetric struct {
+// 		Latency float64 `type:"latency" report:"w99,w99co,c99.9co" unit:"ms" scale:"1e-6" expected:"10ms"`
+// 	}
+//
+// Derived metrics are computed from the struct's other metrics at every report, by a field tagged with a "derived" expression.
+// The expression may use numbers, + - * / and parentheses, and refer to other metrics by name, which stands for the sum of their values, or to one of their reports, as in "Latency[w99]".
+// Numbers may have an exponent, as in "1e3", and dividing by zero gives 0, so a ratio reads 0 in an idle interval rather than NaN.
+// A derived metric's "iter" report evaluates the expression over the sums for the latest interval, and its "cum" report over the sums for the whole run.
+// Since derived fields hold no data, they may be blank:
+//
+// 	type CacheMetric struct {
+// 		Hits    int64    `type:"counter" report:"iter"`
+// 		Misses  int64    `type:"counter" report:"iter"`
+// 		Latency float64  `type:"latency" report:"w99"`
+// 		HitRate struct{} `derived:"100*Hits/(Hits+Misses)" report:"iter,cum" format:"%.1f"`
+// 		_       struct{} `derived:"Latency[w99]*1000" report:"iter" name:"w99us"`
+// 	}
+//
+// A single channel may carry several different metric struct types.  Each
+// value is dispatched by its concrete type to the metric sets started for
+// that type, so each type gets its own header section.
 package olbermann
 
 import (
@@ -29,10 +103,15 @@ var (
 //
 // Must create with C a channel of structs or pointers to structs defined with tags explaining the metrics to track and how to report them.
 //
-// Can Start() multiple reporting goroutines off the same Reporter.
+// Can Start() multiple Stylers off the same Reporter, for the same or for different metric struct types.
+// Values sent down C are only reported by the Stylers started with a sample of the same type.
 //
 // Must invoke Feed() on a goroutine to pull metrics off the stream.
 //
+// Besides printing them with Stylers, current values can be read in-process with Snapshot().
+//
+// To report a run again later, with different reports or Stylers, set Recorder to record the values fed, and feed them to a new Reporter with Replay() instead of Feed().
+//
 // Usage:
 // 	type ReportableMetric struct {
 // 		Ips int64   `type:"counter" report:"iter,cum"`
@@ -44,7 +123,7 @@ var (
 // 		metricChannel := make(chan interface{}, 100)
 // 		r := olbermann.Reporter{C: metricChannel}
 // 		go r.Feed()
-// 		if err := r.Start(ReportableMetric{}, &olbermann.BasicDstatStyler); err != nil {
+// 		if err := r.Start(ReportableMetric{}, olbermann.NewBasicDstatStyler()); err != nil {
 // 			return
 // 		}
 //              defer r.Close()
@@ -53,10 +132,23 @@ var (
 // 		}
 // 	}
 type Reporter struct {
-	C      <-chan interface{}
-	msts   []*metricSetType
-	lock   sync.RWMutex
-	killer chan bool
+	C        <-chan interface{}
+	OnAlert  func(AlertEvent) // If not nil, called whenever an alert rule fires
+	Recorder *Recorder        // If not nil, records every value Feed takes from C
+	msts     []*metricSetType
+	byType   map[reflect.Type]*metricSetType
+	subs     []*subscription
+	alerts   []*alertRule
+	latest   Snapshot
+	// assertions to check at Close, and their results
+	assertions []Condition
+	results    []AssertionResult
+	// while replaying, the recorded times stand in for the clock
+	replaying  bool
+	replayTime time.Time
+	lock       sync.RWMutex
+	killer     chan bool
+	wg         sync.WaitGroup
 }
 
 // Feed is a long-running function that consumes input to the reporter's channel until the channel is closed.
@@ -64,93 +156,332 @@ type Reporter struct {
 // Should be done on a goroutine.
 func (r *Reporter) Feed() {
 	for val := range r.C {
-		r.lock.RLock()
-		for i := range r.msts {
-			if r.msts[i] != nil {
-				r.msts[i].update(val)
-			}
+		if r.Recorder != nil {
+			r.Recorder.record(time.Now(), val)
 		}
-		r.lock.RUnlock()
+		r.feed(val)
 	}
 }
 
+// feed dispatches val to the metric set for its type, if one was started.
+func (r *Reporter) feed(val interface{}) {
+	rtype := typeOf(val)
+	r.lock.RLock()
+	mst := r.byType[rtype]
+	r.lock.RUnlock()
+	if mst != nil {
+		mst.update(val)
+	}
+}
+
+// typeOf returns the struct type of val, a struct or a pointer to one.
+func typeOf(val interface{}) (rtype reflect.Type) {
+	rtype = reflect.TypeOf(val)
+	if rtype != nil && rtype.Kind() == reflect.Ptr {
+		rtype = rtype.Elem()
+	}
+	return
+}
+
 // A Styler describes how, when, and where to display results.
 //
 // Current implementations:
 //
+//  - ChartStyler
 //  - CsvStyler
+//  - Dashboard
 //  - DstatStyler
+//  - HTMLStyler
+//  - MultiStyler
+//  - TUIStyler
 type Styler interface {
 	period() time.Duration
 	linesBetweenHeaders() int
-	printHeader(mst *metricSetType)
-	printValues(curTime time.Time, mst *metricSetType, msv *metricSetValue)
+	printHeader(msv *metricSetValue)
+	printValues(curTime time.Time, msv *metricSetValue)
+}
+
+// alertPrinter is implemented by Stylers that print alerts as they fire.
+type alertPrinter interface {
+	printAlert(ev *AlertEvent)
+}
+
+// checker is implemented by Stylers whose settings can be wrong, for Start
+// to check before printing anything.
+type checker interface {
+	check() error
+}
+
+// setClaimer is implemented by Stylers that can only print one metric set,
+// such as a CsvStyler, whose rows must all have the same columns.  claim
+// returns an error if the Styler was already claimed for another type.
+type setClaimer interface {
+	claim(rtype reflect.Type) error
+}
+
+// A finalReport is what the Reporter knows at Close.
+type finalReport struct {
+	snapshot   Snapshot
+	values     []*metricSetValue // The final values of every metric set
+	alerts     []AlertCount
+	assertions []AssertionResult
+}
+
+// finalPrinter is implemented by Stylers that print a final report at Close.
+type finalPrinter interface {
+	printFinal(report *finalReport)
+}
+
+// A subscription is a Styler printing the values of one metric set.
+type subscription struct {
+	styler           Styler
+	mst              *metricSetType
+	lastLayout       string
+	linesSinceHeader int
+}
+
+// printHeaderIfNeeded prints a header at the start, whenever series for
+// new labels have appeared, and every linesBetweenHeaders lines.
+func (sub *subscription) printHeaderIfNeeded(msv *metricSetValue) {
+	if len(msv.metrics) == 0 {
+		return
+	}
+	lbh := sub.styler.linesBetweenHeaders()
+	layout := msv.layout()
+	if lbh >= 0 && layout != sub.lastLayout || lbh > 0 && sub.linesSinceHeader > lbh {
+		sub.linesSinceHeader = 0
+		sub.lastLayout = layout
+		sub.styler.printHeader(msv)
+	}
+}
+
+func (sub *subscription) print(msv *metricSetValue) {
+	sub.printHeaderIfNeeded(msv)
+	sub.styler.printValues(msv.time, msv)
+	sub.linesSinceHeader++
+}
+
+// metricSetFor returns the metric set for sample's type, creating it if
+// this is the first time the type has been started.
+func (r *Reporter) metricSetFor(sample interface{}) (mst *metricSetType, err error) {
+	newMst, err := newMetricSetTypeOf(sample)
+	if err != nil {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if mst = r.byType[newMst.rtype]; mst != nil {
+		newMst.close()
+		return
+	}
+	if r.byType == nil {
+		r.byType = make(map[reflect.Type]*metricSetType)
+	}
+	mst = newMst
+	mst.start(time.Now())
+	r.msts = append(r.msts, mst)
+	r.byType[mst.rtype] = mst
+	for i := range mst.metrics {
+		for _, ar := range mst.metrics[i].alerts {
+			ar.set = mst.rtype.String()
+			r.alerts = append(r.alerts, ar)
+		}
+	}
+	return
 }
 
-// Start creates a goroutine printing the Reporter's metrics according to the provided Styler.
+// Start begins printing the Reporter's metrics according to the provided Styler.
 //
 // You must call Close later.
 //
 // Needs a sample object to initialize some state, the zero value for the metric will do.
+// The sample's whole struct definition is checked first; if anything is wrong with it, Start returns a *ValidationError naming every bad field, tag and value.
+// Start also fails if the Styler's settings are wrong, such as a TUIStyler threshold that doesn't parse, or if the Styler can only print one metric struct type, as a CsvStyler can, and was already started for another.
+// Only values of the sample's type (or pointers to it) are reported to this Styler.
+//
+// Every Styler started for the same type sees the same values: the Reporter aggregates each type once, and at every interval hands the same results to each Styler and to Snapshot.
 //
 // Usage:
-// 	if err := r.Start(ReportableMetric{}, &BasicDstatStyler); err != nil {
+// 	if err := r.Start(ReportableMetric{}, NewBasicDstatStyler()); err != nil {
 // 		return
 // 	}
 // 	defer r.Close()
 func (r *Reporter) Start(sample interface{}, styler Styler) (err error) {
-	sampleType := reflect.TypeOf(sample)
-	if sampleType.Kind() == reflect.Ptr {
-		sampleType = sampleType.Elem()
+	if c, ok := styler.(checker); ok {
+		if err = c.check(); err != nil {
+			return
+		}
 	}
-	mst, err := newMetricSetType(sampleType)
+	if c, ok := styler.(setClaimer); ok {
+		if err = Validate(sample); err != nil {
+			return
+		}
+		if err = c.claim(typeOf(sample)); err != nil {
+			return
+		}
+	}
+	mst, err := r.metricSetFor(sample)
 	if err != nil {
 		return
 	}
-	r.killer = make(chan bool)
+	if hs, ok := styler.(histogramStyler); ok && hs.wantsHistograms() {
+		mst.keepHistograms()
+	}
+	sub := &subscription{styler: styler, mst: mst}
+	sub.printHeaderIfNeeded(mst.getLayout())
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.subs = append(r.subs, sub)
+	if r.killer != nil {
+		return
+	}
+	killer := make(chan bool)
+	r.killer = killer
+	r.wg.Add(1)
 	go func() {
-		r.lock.Lock()
-		idx := len(r.msts)
-		r.msts = append(r.msts, mst)
-		r.lock.Unlock()
-		defer func() {
-			r.lock.Lock()
-			r.msts[idx].close()
-			r.msts[idx] = nil
-			r.lock.Unlock()
-		}()
-
-		var linesSinceHeader int
-		if styler.linesBetweenHeaders() >= 0 {
-			styler.printHeader(mst)
-		}
-
-		startTime := time.Now()
-		lastTime := startTime
-		ticker := time.Tick(time.Duration(*outputSecondsInterval) * time.Second)
+		defer r.wg.Done()
+		ticker := time.NewTicker(time.Duration(*outputSecondsInterval) * time.Second)
+		defer ticker.Stop()
 		for {
 			select {
-			case <-r.killer:
+			case <-killer:
 				return
-			case curTime := <-ticker:
-				tDiff := curTime.Sub(lastTime)
-				tTotal := curTime.Sub(startTime)
-				lastTime = curTime
-				msv := mst.getValues(tDiff, tTotal)
-				if styler.linesBetweenHeaders() > 0 && linesSinceHeader > styler.linesBetweenHeaders() {
-					linesSinceHeader = 0
-					styler.printHeader(mst)
-				}
-				styler.printValues(curTime, mst, msv)
-				linesSinceHeader++
+			case curTime := <-ticker.C:
+				r.tick(curTime)
 			}
 		}
 	}()
 	return
 }
 
-// Close stops the reporter's internal goroutine.
+// collect ends the current interval of every metric set at curTime,
+// returning the values of each, in the order they were started, a Snapshot
+// of them all, and the subscriptions to print them to.  The metric sets and
+// subscriptions are read together, so every subscription's set has a value.
+func (r *Reporter) collect(curTime time.Time) (snapshot Snapshot, values []*metricSetValue, subs []*subscription) {
+	r.lock.RLock()
+	msts := r.msts
+	subs = r.subs
+	r.lock.RUnlock()
+	snapshot.Time = curTime
+	for i := range msts {
+		msv := msts[i].tick(curTime)
+		values = append(values, msv)
+		if i == 0 || msv.cumDuration > snapshot.Elapsed {
+			snapshot.Interval, snapshot.Elapsed = msv.iterDuration, msv.cumDuration
+		}
+		snapshot.Metrics = msv.appendSnapshot(msts[i].rtype.String(), snapshot.Metrics)
+	}
+	return
+}
+
+// tick ends the current interval of every metric set at curTime, hands the
+// values to every Styler and to Snapshot, and checks alert rules.
+func (r *Reporter) tick(curTime time.Time) {
+	snapshot, values, subs := r.collect(curTime)
+	msvs := make(map[reflect.Type]*metricSetValue)
+	for _, msv := range values {
+		msvs[msv.rtype] = msv
+	}
+	r.lock.Lock()
+	r.latest = snapshot
+	var events []AlertEvent
+	var callbacks []func(AlertEvent)
+	for i := range r.alerts {
+		fired := r.alerts[i].check(&snapshot)
+		events = append(events, fired...)
+		for range fired {
+			callbacks = append(callbacks, r.alerts[i].callback)
+		}
+	}
+	onAlert := r.OnAlert
+	r.lock.Unlock()
+	for i := range subs {
+		subs[i].print(msvs[subs[i].mst.rtype])
+		if ap, ok := subs[i].styler.(alertPrinter); ok {
+			for j := range events {
+				if events[j].Set == subs[i].mst.rtype.String() {
+					ap.printAlert(&events[j])
+				}
+			}
+		}
+	}
+	for i := range events {
+		if callbacks[i] != nil {
+			callbacks[i](events[i])
+		}
+		if onAlert != nil {
+			onAlert(events[i])
+		}
+	}
+}
+
+// stylers returns every Styler started, once each, however many metric
+// sets it was started for.
+func (r *Reporter) stylers() (stylers []Styler) {
+	seen := make(map[Styler]bool)
+	for i := range r.subs {
+		styler := r.subs[i].styler
+		if !reflect.TypeOf(styler).Comparable() {
+			stylers = append(stylers, styler)
+			continue
+		}
+		if !seen[styler] {
+			seen[styler] = true
+			stylers = append(stylers, styler)
+		}
+	}
+	return
+}
+
+// Close stops the reporter's internal goroutines, waits for them to finish, and has each Styler print a final report, once however many metric sets it was started for.
+//
+// The final report covers everything fed to the Reporter, including what came in after the last interval was printed.
+// Assertions added with Assert are checked against it, and their results can be read afterwards with AssertionResults.
+//
+// The Reporter can be started again after Close.  Rules added with Alert and assertions added with Assert carry over to the next run, and alert counts start again from zero.
 func (r *Reporter) Close() {
-	r.killer <- true
-	close(r.killer)
+	r.lock.Lock()
+	killer := r.killer
+	r.killer = nil
+	r.lock.Unlock()
+	if killer == nil {
+		return
+	}
+	close(killer)
+	r.wg.Wait()
+	if r.Recorder != nil {
+		r.Recorder.Flush()
+	}
+	snapshot, values, _ := r.collect(r.now())
+	report := &finalReport{snapshot: snapshot, values: values, alerts: r.AlertCounts()}
+	r.lock.Lock()
+	r.latest = snapshot
+	report.assertions = checkAssertions(r.assertions, &snapshot)
+	r.results = report.assertions
+	stylers := r.stylers()
+	for i := range r.msts {
+		r.msts[i].close()
+	}
+	r.msts = nil
+	r.byType = nil
+	r.subs = nil
+	// Rules from tags come back with their metric sets; those added with
+	// Alert are kept, but start the next run afresh.
+	var rules []*alertRule
+	for _, ar := range r.alerts {
+		if ar.set == "" {
+			ar.reset()
+			rules = append(rules, ar)
+		}
+	}
+	r.alerts = rules
+	r.replaying = false
+	r.lock.Unlock()
+	// Print outside the lock, so a slow Styler doesn't hold up Feed.
+	for _, styler := range stylers {
+		if fp, ok := styler.(finalPrinter); ok {
+			fp.printFinal(report)
+		}
+	}
 }
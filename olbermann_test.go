@@ -2,21 +2,25 @@ package olbermann
 
 import (
 	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
 	"log"
 	"math/rand"
 	"os"
+	"reflect"
+	"strings"
+	"testing"
 	"time"
 )
 
 type exampleValueSet struct {
 	A int `type:"counter" report:"iter,total"`
 	B int `type:"counter" report:"ewma1,cum,total"`
-	//Tps int `type:"counter" report:"iter,cum" name:"tps"`
 }
 
 func gen(c chan<- interface{}) {
 	for i := 0; i < 10; i++ {
-		//c <- &exampleValueSet{A: 1, B: 1, Tps: 198273}
 		c <- &exampleValueSet{A: 1, B: 1}
 		time.Sleep(400 * time.Millisecond)
 	}
@@ -37,21 +41,21 @@ func Example() {
 	gen(c)
 	close(c)
 	// Output:
-	// example: ----------- a ------------ ------------------ b ------------------
-	// example:         iter        total |        ewma1          cum        total
-	// example:         2.00            2 |         0.00         2.00            2
-	// example:         1.00            4 |         0.00         2.00            4
-	// example:         1.00            7 |         0.00         2.33            7
-	// example:         0.50            9 |         0.00         2.25            9
+	// example: ----- a ------ --------- b ---------
+	// example:   iter  total |  ewma1    cum  total
+	// example:   2.00      2 |   0.00   2.00      2
+	// example:   1.00      4 |   0.00   2.00      4
+	// example:   1.00      7 |   0.00   2.33      7
+	// example:   0.50      9 |   0.00   2.25      9
 }
 
 // This output is too high precision to be an accurate test, but this is about what it would produce:
 // Output:
-// time,"A iter","A total","B ewma1","B cum","B total"
-// "2014-04-12 00:41:06.921153316 -0400 EDT",1.999723,2.000000,1.999723,1.999723,2.000000
-// "2014-04-12 00:41:07.921158351 -0400 EDT",0.999928,4.000000,1.935220,1.999856,4.000000
-// "2014-04-12 00:41:08.921147586 -0400 EDT",0.999956,7.000000,1.874880,2.333230,7.000000
-// "2014-04-12 00:41:09.921124252 -0400 EDT",0.499986,9.000000,1.786177,2.249938,9.000000
+// time,A iter,A total,B ewma1,B cum,B total
+// 2014-04-12T00:41:06.921153316-04:00,1.999723,2.000000,1.999723,1.999723,2.000000
+// 2014-04-12T00:41:07.921158351-04:00,0.999928,4.000000,1.935220,1.999856,4.000000
+// 2014-04-12T00:41:08.921147586-04:00,0.999956,7.000000,1.874880,2.333230,7.000000
+// 2014-04-12T00:41:09.921124252-04:00,0.499986,9.000000,1.786177,2.249938,9.000000
 func ExampleCsv() {
 	c := make(chan interface{}, 10)
 	r := &Reporter{C: c}
@@ -97,3 +101,145 @@ func ExampleLatency() {
 	genLats(c)
 	close(c)
 }
+
+// A testRun drives a Reporter by hand, a second at a time, without waiting
+// on real time or racing its ticker.
+type testRun struct {
+	r     *Reporter
+	mst   *metricSetType
+	start time.Time
+	n     int
+}
+
+// startTestRun starts styler on r for sample's type, without the ticker.
+func startTestRun(t *testing.T, r *Reporter, sample interface{}, styler Styler) *testRun {
+	t.Helper()
+	start := time.Now()
+	tickByHand(r, start)
+	if err := r.Start(sample, styler); err != nil {
+		t.Fatal(err)
+	}
+	mst, _ := r.metricSetFor(sample)
+	return &testRun{r: r, mst: mst, start: start}
+}
+
+// tickByHand keeps r from starting its ticker, and has it take the times
+// it's ticked at for the clock from start on, as Replay does, so Close
+// ends the last interval when the test says it did.
+func tickByHand(r *Reporter, start time.Time) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.killer == nil {
+		r.killer = make(chan bool)
+		r.replaying = true
+		r.replayTime = start
+	}
+}
+
+// interval feeds vals, then ends the next interval, a second after the
+// last.
+func (tr *testRun) interval(vals ...interface{}) {
+	for _, val := range vals {
+		tr.mst.update(val)
+	}
+	tr.n++
+	curTime := tr.start.Add(time.Duration(tr.n) * time.Second)
+	tr.r.setReplayTime(curTime)
+	tr.r.tick(curTime)
+}
+
+type insertValueSet struct {
+	Inserts int `type:"counter" report:"total"`
+}
+
+type queryValueSet struct {
+	Queries int     `type:"counter" report:"total"`
+	Latency float64 `type:"latency" report:"c50"`
+}
+
+func TestFeedDispatchesByType(t *testing.T) {
+	c := make(chan interface{}, 10)
+	r := &Reporter{C: c}
+	insertMst, err := r.metricSetFor(insertValueSet{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	queryMst, err := r.metricSetFor(&queryValueSet{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := r.metricSetFor(&insertValueSet{}); again != insertMst {
+		t.Error("expected one metric set per type")
+	}
+	c <- insertValueSet{Inserts: 3}
+	c <- &queryValueSet{Queries: 1, Latency: 7}
+	c <- &insertValueSet{Inserts: 4}
+	close(c)
+	r.Feed()
+
+	insertMsv := insertMst.getValues(time.Second, time.Second)
+	if insertMsv.metrics[0].reports[0].value != 7 {
+		t.Error("expected 7 inserts, got", insertMsv.metrics[0].reports[0].value)
+	}
+	queryMsv := queryMst.getValues(time.Second, time.Second)
+	if queryMsv.metrics[0].reports[0].value != 1 {
+		t.Error("expected 1 query, got", queryMsv.metrics[0].reports[0].value)
+	}
+	if queryMsv.metrics[1].reports[0].value != 7 {
+		t.Error("expected query latency 7, got", queryMsv.metrics[1].reports[0].value)
+	}
+}
+
+func TestStylersShareValues(t *testing.T) {
+	r := &Reporter{}
+	var first, second bytes.Buffer
+	tr := startTestRun(t, r, latencyValueSet{}, &CsvStyler{Writer: bufio.NewWriter(&first)})
+	defer r.Close()
+	if err := r.Start(&latencyValueSet{}, &CsvStyler{Writer: bufio.NewWriter(&second)}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 3; i++ {
+		for j := 0; j < 10; j++ {
+			tr.mst.update(latencyValueSet{Latency: float64(i * j)})
+		}
+		tr.interval()
+	}
+	if first.String() != second.String() {
+		t.Errorf("expected both stylers to print the same values, got\n%s\nand\n%s", first.String(), second.String())
+	}
+	if lines := strings.Count(first.String(), "\n"); lines != 4 {
+		t.Errorf("expected a header and 3 lines of values, got %d lines", lines)
+	}
+}
+
+func TestStartWhileTicking(t *testing.T) {
+	r := &Reporter{}
+	tickByHand(r, time.Now())
+	done := make(chan bool)
+	ticked := make(chan bool)
+	go func() {
+		defer close(ticked)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				r.tick(time.Now())
+			}
+		}
+	}()
+	// Start a new type each time, so every Start adds a metric set.
+	for i := 0; i < 1000; i++ {
+		rtype := reflect.StructOf([]reflect.StructField{{
+			Name: fmt.Sprintf("N%d", i),
+			Type: reflect.TypeOf(0),
+			Tag:  `type:"counter" report:"total"`,
+		}})
+		if err := r.Start(reflect.Zero(rtype).Interface(), &CsvStyler{Writer: bufio.NewWriter(ioutil.Discard)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(done)
+	<-ticked
+	r.Close()
+}
@@ -0,0 +1,173 @@
+package olbermann
+
+import (
+	"bufio"
+	"encoding/gob"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A recordedValue is one value fed to a Reporter, and when it arrived.
+type recordedValue struct {
+	Time  time.Time
+	Value interface{}
+}
+
+// A Recorder writes every value fed to a Reporter, with the time it
+// arrived, to a gob stream.  Reporter.Replay can later feed the stream
+// back through a Reporter, to report the same run with different reports
+// or Stylers without running it again.
+//
+// Usage:
+// 	f, err := os.Create("run.gob")
+// 	if err != nil {
+// 		return err
+// 	}
+// 	defer f.Close()
+// 	rec := olbermann.NewRecorder(f)
+// 	r := &olbermann.Reporter{C: c, Recorder: rec}
+// 	go r.Feed()
+// 	...
+// 	r.Close()
+// 	if err := rec.Flush(); err != nil {
+// 		return err
+// 	}
+type Recorder struct {
+	w     *bufio.Writer
+	enc   *gob.Encoder
+	types map[reflect.Type]bool
+	err   error
+	lock  sync.Mutex
+}
+
+// NewRecorder returns a Recorder writing to w.
+func NewRecorder(w io.Writer) *Recorder {
+	bw := bufio.NewWriter(w)
+	return &Recorder{w: bw, enc: gob.NewEncoder(bw), types: make(map[reflect.Type]bool)}
+}
+
+// registerGob tells gob about val's type, so it can be sent as an
+// interface value.  Types the program already registered under another
+// name are left alone; anything else gob panics about still panics.
+func registerGob(val interface{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			if msg, ok := r.(string); !ok || !strings.HasPrefix(msg, "gob: registering duplicate") {
+				panic(r)
+			}
+		}
+	}()
+	gob.Register(val)
+}
+
+// record writes val, fed at t.  After the first error, nothing more is
+// written.
+func (rec *Recorder) record(t time.Time, val interface{}) {
+	if val == nil {
+		return
+	}
+	rec.lock.Lock()
+	defer rec.lock.Unlock()
+	if rec.err != nil {
+		return
+	}
+	if rtype := reflect.TypeOf(val); !rec.types[rtype] {
+		rec.types[rtype] = true
+		registerGob(val)
+	}
+	rec.err = rec.enc.Encode(&recordedValue{Time: t, Value: val})
+}
+
+// Flush writes any buffered values to the underlying writer.  It returns
+// the first error met while recording, if any.
+func (rec *Recorder) Flush() error {
+	rec.lock.Lock()
+	defer rec.lock.Unlock()
+	if rec.err == nil {
+		rec.err = rec.w.Flush()
+	}
+	return rec.err
+}
+
+// Replay feeds the Reporter the values a Recorder wrote to rd, in place of
+// Feed and C.  Start the Stylers first, and Close the Reporter once Replay
+// returns.
+//
+// The Reporter's intervals follow the recorded times rather than the
+// clock, so a replay reports what the original run did however fast it
+// goes.  Values are sent speed times faster than they were recorded, or if
+// speed is zero or less, as fast as possible.
+//
+// Values of the types Started are decoded as they were recorded.  Values
+// of any other type in the recording must be registered with gob.Register
+// beforehand, or Replay fails to decode them.
+func (r *Reporter) Replay(rd io.Reader, speed float64) (err error) {
+	r.lock.Lock()
+	killer := r.killer
+	r.killer = make(chan bool)
+	r.replaying = true
+	r.replayTime = time.Now()
+	msts := r.msts
+	r.lock.Unlock()
+	// Stop the ticker, the recorded times take over from here.
+	if killer != nil {
+		close(killer)
+		r.wg.Wait()
+	}
+	for i := range msts {
+		registerGob(reflect.Zero(msts[i].rtype).Interface())
+		registerGob(reflect.New(msts[i].rtype).Interface())
+	}
+
+	interval := time.Duration(*outputSecondsInterval) * time.Second
+	dec := gob.NewDecoder(rd)
+	var start, next, wallStart time.Time
+	wait := func(t time.Time) {
+		if speed > 0 {
+			time.Sleep(time.Duration(float64(t.Sub(start))/speed) - time.Since(wallStart))
+		}
+	}
+	for {
+		var rv recordedValue
+		if err = dec.Decode(&rv); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return
+		}
+		if start.IsZero() {
+			start, next, wallStart = rv.Time, rv.Time.Add(interval), time.Now()
+			for i := range msts {
+				msts[i].start(start)
+			}
+		}
+		for !rv.Time.Before(next) {
+			wait(next)
+			r.setReplayTime(next)
+			r.tick(next)
+			next = next.Add(interval)
+		}
+		wait(rv.Time)
+		r.setReplayTime(rv.Time)
+		r.feed(rv.Value)
+	}
+}
+
+func (r *Reporter) setReplayTime(t time.Time) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.replayTime = t
+}
+
+// now is the current time, which during a replay is the latest recorded
+// time.
+func (r *Reporter) now() time.Time {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	if r.replaying {
+		return r.replayTime
+	}
+	return time.Now()
+}
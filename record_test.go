@@ -0,0 +1,117 @@
+package olbermann
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"strings"
+	"testing"
+	"time"
+)
+
+type recordedMetric struct {
+	Op      string  `label:"op"`
+	Ops     int64   `type:"counter" report:"iter,total"`
+	Latency float64 `type:"latency" report:"c50"`
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	c := make(chan interface{}, 4)
+	var buf bytes.Buffer
+	rec := NewRecorder(&buf)
+	r := &Reporter{C: c, Recorder: rec}
+	if err := r.Start(recordedMetric{}, nullStyler{}); err != nil {
+		t.Fatal(err)
+	}
+	c <- recordedMetric{"get", 2, 10}
+	c <- &recordedMetric{"put", 1, 20}
+	c <- insertValueSet{Inserts: 5}
+	c <- recordedMetric{"get", 3, 30}
+	close(c)
+	r.Feed()
+	r.Close()
+	if err := rec.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	original := r.Snapshot()
+
+	replayed := &Reporter{}
+	if err := replayed.Start(recordedMetric{}, nullStyler{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := replayed.Start(insertValueSet{}, nullStyler{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := replayed.Replay(&buf, 0); err != nil {
+		t.Fatal(err)
+	}
+	replayed.Close()
+	s := replayed.Snapshot()
+	for _, name := range []string{"Ops{op=get}", "Ops{op=put}", "Latency{op=get}"} {
+		for _, report := range []string{"total", "c50"} {
+			want, _ := original.Value(name, report)
+			if got, _ := s.Value(name, report); got != want {
+				t.Errorf("expected the replay to report %v for %s %s, got %v", want, name, report, got)
+			}
+		}
+	}
+	if v, _ := s.Value("Inserts", "total"); v != 5 {
+		t.Error("expected 5 recorded inserts, got", v)
+	}
+}
+
+func TestReplayFollowsRecordedTime(t *testing.T) {
+	var buf bytes.Buffer
+	rec := NewRecorder(&buf)
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	// Ten ops a second for three and a half recorded seconds.
+	for i := 0; i < 35; i++ {
+		rec.record(start.Add(time.Duration(i)*100*time.Millisecond), &insertValueSet{Inserts: 1})
+	}
+	if err := rec.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	r := &Reporter{}
+	if err := r.Start(insertValueSet{}, &CsvStyler{Writer: bufio.NewWriter(&out)}); err != nil {
+		t.Fatal(err)
+	}
+	began := time.Now()
+	if err := r.Replay(&buf, 0); err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(began) > time.Second {
+		t.Error("expected a replay at full speed to take well under the recorded time")
+	}
+	r.Close()
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected a header and a line for each of 3 recorded seconds, got\n%s", out.String())
+	}
+	if !strings.HasPrefix(lines[3], start.Add(3*time.Second).Format(time.RFC3339Nano)) {
+		t.Error("expected lines stamped with recorded times, got", lines[3])
+	}
+	s := r.Snapshot()
+	if s.Elapsed != 3400*time.Millisecond {
+		t.Error("expected the final report to end at the last recorded value, got", s.Elapsed)
+	}
+	if v, _ := s.Value("Inserts", "total"); v != 35 {
+		t.Error("expected 35 inserts, got", v)
+	}
+}
+
+type renamedMetric struct {
+	Ops int64 `type:"counter" report:"total"`
+}
+
+func TestRegisterGob(t *testing.T) {
+	gob.RegisterName("program.Renamed", renamedMetric{})
+	registerGob(renamedMetric{})
+	defer func() {
+		if recover() == nil {
+			t.Error("expected other panics from gob to get through")
+		}
+	}()
+	registerGob(nil)
+}
@@ -2,7 +2,12 @@ package olbermann
 
 import (
 	"errors"
+	"fmt"
 	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -19,56 +24,360 @@ func toFloat(fval reflect.Value) float64 {
 	}
 }
 
+func toLabel(fval reflect.Value) string {
+	switch fval.Kind() {
+	case reflect.String:
+		return fval.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return fmt.Sprint(fval.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return fmt.Sprint(fval.Uint())
+	case reflect.Bool:
+		return fmt.Sprint(fval.Bool())
+	default:
+		panic("wrong kind for label " + fval.Kind().String())
+	}
+}
+
+// labelLess orders label values of one kind, numbers by value rather than
+// by their labels, so shard=2 comes before shard=10.
+func labelLess(a, b reflect.Value) bool {
+	switch a.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return a.Int() < b.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return a.Uint() < b.Uint()
+	}
+	return toLabel(a) < toLabel(b)
+}
+
+func isLabelKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// joinLabels combines two "dim=value" label strings into one.
+func joinLabels(a, b string) string {
+	switch {
+	case a == "":
+		return b
+	case b == "":
+		return a
+	default:
+		return a + "," + b
+	}
+}
+
+// A reportType accumulates the values of a metric and reports one
+// quantity about them.  Reading a value with get doesn't change anything,
+// roll is called once the values for an interval have been reported, to
+// start the next one.
 type reportType interface {
 	name() string
 	add(fval reflect.Value)
 	get(iterDuration time.Duration, cumDuration time.Duration) float64
+	roll()
 	string(val float64) string
 	close()
 }
 
-type metricType struct {
-	name    string
+// splitReportNames returns the names in a metric's "report" tag, checking
+// that there is at least one and that none is empty or repeated.
+func splitReportNames(field reflect.StructField, errs *fieldErrors) (names []string) {
+	tag := field.Tag.Get("report")
+	if tag == "" {
+		errs.add(field, "report", "metric must define reports")
+		return
+	}
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(tag, ",") {
+		switch {
+		case name == "":
+			errs.add(field, "report", "empty report name")
+		case seen[name]:
+			errs.add(field, "report", "duplicate report "+strconv.Quote(name))
+		default:
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return
+}
+
+// A metricSeries is the set of reports kept for one combination of label
+// values of a metric.  Metrics without labels have exactly one series,
+// with empty labels.
+type metricSeries struct {
+	labels  string
 	reports []reportType
+	// sums of the values added, in the current interval and overall, kept
+	// only if summed, for derived metrics that refer to the metric itself
+	summed  bool
+	iterSum float64
+	cumSum  float64
+	// histograms of the values added, in the current interval and
+	// overall, for latency metrics
+	iterHist *histogram
+	cumHist  *histogram
+}
+
+func (ms *metricSeries) add(fval reflect.Value) {
+	v := toFloat(fval)
+	if ms.summed {
+		ms.iterSum += v
+		ms.cumSum += v
+	}
+	if ms.iterHist != nil {
+		ms.iterHist.insert(v)
+		ms.cumHist.insert(v)
+	}
+	for j := range ms.reports {
+		ms.reports[j].add(fval)
+	}
+}
+
+type metricType struct {
+	// display name, from the "name" tag or the field's (dotted) name
+	name string
+	// the field's (dotted) name
+	field string
+	// whether name came from a "name" tag
+	named  bool
+	format *valueFormat
+	// index sequence of the (possibly nested) field in the metric struct
+	index []int
+	// for map-valued fields, the label dimension the map's keys fan out
+	// into ("" if the keys are used as labels on their own)
+	mapLabel    string
+	isMap       bool
+	derived     *derivedMetric
+	alerts      []*alertRule
+	reportNames []string
+	newReports  func() []reportType
+	// whether it's a latency metric, whose series can keep histograms
+	latency bool
+	// whether series keep histograms of their values, once a Styler asks
+	histograms bool
+	// whether series keep sums of their values, because a derived metric
+	// refers to it without naming a report
+	summed   bool
+	series   []*metricSeries
+	byLabels map[string]*metricSeries
+	// the only series of a plain metric in a set without label fields,
+	// which values are added to directly
+	single *metricSeries
+}
+
+// seriesFor returns the series for the given labels, creating it if this
+// is the first time they have been seen.
+func (mt *metricType) seriesFor(labels string) *metricSeries {
+	if ms, ok := mt.byLabels[labels]; ok {
+		return ms
+	}
+	ms := &metricSeries{labels: labels, reports: mt.newReports(), summed: mt.summed}
+	if mt.histograms {
+		ms.iterHist, ms.cumHist = newHistogram(), newHistogram()
+	}
+	mt.series = append(mt.series, ms)
+	mt.byLabels[labels] = ms
+	return ms
+}
+
+// A labelType is a field with a "label" tag, whose value selects which
+// series the rest of the struct's metrics are added to.
+type labelType struct {
+	name  string
+	field string
+	index []int
 }
 
 type metricSetType struct {
-	metrics []metricType
+	rtype   reflect.Type
+	labels  []labelType
+	metrics []*metricType
+	// when reporting started, and when the current interval started
+	startTime time.Time
+	lastTime  time.Time
+	lock      sync.Mutex
 }
 
 func newMetricSetTypeOf(val interface{}) (mst *metricSetType, err error) {
-	rtype := reflect.TypeOf(val)
-	if rtype.Kind() == reflect.Ptr {
-		rtype = rtype.Elem()
-	}
-	if rtype.Kind() != reflect.Struct {
-		err = errors.New("invalid kind of metric " + rtype.Kind().String())
+	rtype := typeOf(val)
+	if rtype == nil || rtype.Kind() != reflect.Struct {
+		name := "nil"
+		if rtype != nil {
+			name = rtype.String()
+		}
+		err = &ValidationError{Type: name, Errors: []*FieldError{{Msg: "not a struct or a pointer to one"}}}
 		return
 	}
 	return newMetricSetType(rtype)
 }
 
+// newMetricSetType builds the metricSetType for a metric struct, or
+// returns a *ValidationError listing every problem with its definitions.
 func newMetricSetType(rtype reflect.Type) (mst *metricSetType, err error) {
-	newMst := new(metricSetType)
-	newMst.metrics = make([]metricType, rtype.NumField())
+	newMst := &metricSetType{rtype: rtype}
+	var errs fieldErrors
+	newMst.addFields(rtype, "", nil, &errs)
+	newMst.checkNames(&errs)
+	newMst.resolveDerived(&errs)
+	if len(errs) > 0 {
+		err = &ValidationError{Type: rtype.String(), Errors: errs}
+		return
+	}
+	if len(newMst.labels) == 0 {
+		// Without label fields, plain metrics always have their single
+		// series, so headers can be printed before any data arrives, and
+		// values needn't look their series up.
+		for i := range newMst.metrics {
+			if mt := newMst.metrics[i]; !mt.isMap && mt.derived == nil {
+				mt.single = mt.seriesFor("")
+			}
+		}
+	}
+	mst = newMst
+	return
+}
+
+func isNumericKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// addFields adds the metrics and labels defined by the fields of rtype,
+// recursing into nested structs.  Fields of a named nested struct get its
+// name as a dotted prefix, fields of an embedded struct are promoted
+// without one.  Fields without a "type" or "label" tag, unexported fields,
+// and fields tagged `olbermann:"-"` are ignored.
+func (mst *metricSetType) addFields(rtype reflect.Type, prefix string, index []int, errs *fieldErrors) {
 	for i := 0; i < rtype.NumField(); i++ {
 		field := rtype.Field(i)
-		switch field.Tag.Get("type") {
-		case "counter":
-			if newMst.metrics[i], err = newCounterMetric(field); err != nil {
-				return
+		if field.Tag.Get("olbermann") == "-" {
+			continue
+		}
+		// Derived metrics hold no data, so they may be declared on blank
+		// (and therefore unexported) fields.
+		isDerived := field.Tag.Get("derived") != ""
+		if field.PkgPath != "" && !field.Anonymous && !isDerived {
+			continue
+		}
+		fieldIndex := append(append([]int(nil), index...), i)
+		field.Name = prefix + field.Name
+		var metric *metricType
+		switch typ := field.Tag.Get("type"); {
+		case isDerived:
+			if typ != "" {
+				errs.add(field, "type", "derived metrics must not have a type")
 			}
-		case "latency":
-			if newMst.metrics[i], err = newLatencyMetric(field); err != nil {
-				return
+			metric = newDerivedMetric(field, errs)
+		case typ == "counter":
+			metric = newCounterMetric(field, errs)
+		case typ == "latency":
+			metric = newLatencyMetric(field, errs)
+		case typ == "":
+			if label := field.Tag.Get("label"); label != "" {
+				if !isLabelKind(field.Type.Kind()) {
+					errs.add(field, "", "label field has invalid kind "+field.Type.Kind().String())
+				}
+				mst.labels = append(mst.labels, labelType{name: label, field: field.Name, index: fieldIndex})
+			} else if field.Type.Kind() == reflect.Struct {
+				nestedPrefix := field.Name + "."
+				if field.Anonymous {
+					nestedPrefix = prefix
+				}
+				mst.addFields(field.Type, nestedPrefix, fieldIndex, errs)
 			}
+			continue
 		default:
-			err = errors.New("metric " + field.Name + " is of unknown type " + field.Tag.Get("type"))
-			return
+			errs.add(field, "type", "unknown metric type, must be counter or latency")
+			continue
+		}
+		metric.field = field.Name
+		metric.index = fieldIndex
+		if name := field.Tag.Get("name"); name != "" {
+			metric.name = prefix + name
+			metric.named = true
+		}
+		metric.format = newValueFormat(field, errs)
+		metric.alerts = newAlertRules(field, metric, errs)
+		metric.byLabels = make(map[string]*metricSeries)
+		mst.metrics = append(mst.metrics, metric)
+		if isDerived {
+			continue
+		}
+		kind := field.Type.Kind()
+		if kind == reflect.Map {
+			if !isLabelKind(field.Type.Key().Kind()) {
+				errs.add(field, "", "map metric has invalid key kind "+field.Type.Key().Kind().String())
+			}
+			kind = field.Type.Elem().Kind()
+			metric.isMap = true
+			metric.mapLabel = field.Tag.Get("label")
+		} else if field.Tag.Get("label") != "" {
+			errs.add(field, "label", "only map-valued metrics may have a label")
+		}
+		if !isNumericKind(kind) {
+			errs.add(field, "", "metric has invalid kind "+kind.String()+", must be numeric")
 		}
 	}
-	mst = newMst
-	return
+}
+
+// checkNames makes sure no two metrics or labels would be reported with
+// the same name.
+func (mst *metricSetType) checkNames(errs *fieldErrors) {
+	metrics := make(map[string]*metricType)
+	for i := range mst.metrics {
+		mt := mst.metrics[i]
+		if first := metrics[mt.name]; first != nil {
+			// Blame the field whose name tag caused the clash.
+			blamed := mt
+			if !mt.named && first.named {
+				blamed = first
+			}
+			fe := &FieldError{Field: blamed.field, Msg: "duplicate metric name"}
+			if blamed.named {
+				fe.Tag, fe.Value = "name", blamed.name
+			}
+			*errs = append(*errs, fe)
+			continue
+		}
+		metrics[mt.name] = mt
+	}
+	labels := make(map[string]bool)
+	for i := range mst.labels {
+		lt := mst.labels[i]
+		if labels[lt.name] {
+			*errs = append(*errs, &FieldError{Field: lt.field, Tag: "label", Value: lt.name, Msg: "duplicate label name"})
+		}
+		labels[lt.name] = true
+	}
+}
+
+func (mst *metricSetType) labelsOf(rval reflect.Value) string {
+	var labels string
+	for i := range mst.labels {
+		lt := mst.labels[i]
+		labels = joinLabels(labels, lt.name+"="+toLabel(rval.FieldByIndex(lt.index)))
+	}
+	return labels
+}
+
+func (mt *metricType) keyLabels(key reflect.Value) string {
+	if mt.mapLabel == "" {
+		return toLabel(key)
+	}
+	return mt.mapLabel + "=" + toLabel(key)
 }
 
 func (mst *metricSetType) update(val interface{}) (err error) {
@@ -77,21 +386,46 @@ func (mst *metricSetType) update(val interface{}) (err error) {
 		err = errors.New("invalid kind of metric " + rval.Kind().String())
 		return
 	}
+	mst.lock.Lock()
+	defer mst.lock.Unlock()
+	var labels string
+	if len(mst.labels) > 0 {
+		labels = mst.labelsOf(rval)
+	}
 	for i := range mst.metrics {
-		rt := mst.metrics[i]
-		val := rval.Field(i)
-		for j := range rt.reports {
-			rt.reports[j].add(val)
+		mt := mst.metrics[i]
+		if mt.single != nil {
+			mt.single.add(rval.FieldByIndex(mt.index))
+			continue
+		}
+		if mt.derived != nil {
+			continue
+		}
+		val := rval.FieldByIndex(mt.index)
+		if !mt.isMap {
+			mt.seriesFor(labels).add(val)
+			continue
+		}
+		keys := val.MapKeys()
+		// Visit keys in a stable order so new series appear predictably.
+		sort.Slice(keys, func(a, b int) bool { return labelLess(keys[a], keys[b]) })
+		for _, key := range keys {
+			mt.seriesFor(joinLabels(labels, mt.keyLabels(key))).add(val.MapIndex(key))
 		}
 	}
 	return
 }
 
 func (mst *metricSetType) close() {
+	mst.lock.Lock()
+	defer mst.lock.Unlock()
 	for i := range mst.metrics {
-		rt := mst.metrics[i]
-		for j := range rt.reports {
-			rt.reports[j].close()
+		mt := mst.metrics[i]
+		for j := range mt.series {
+			ms := mt.series[j]
+			for k := range ms.reports {
+				ms.reports[k].close()
+			}
 		}
 	}
 }
@@ -99,26 +433,151 @@ func (mst *metricSetType) close() {
 type reportValue struct {
 	name  string
 	value float64
+	rt    reportType
 }
 
 type metricValue struct {
 	name    string
+	named   bool
+	labels  string
+	format  *valueFormat
 	reports []reportValue
+	// for latency metrics, histograms of the unscaled values in the
+	// interval and overall
+	iterHist *histogram
+	cumHist  *histogram
+}
+
+// string formats a report's value for people to read.
+func (mv *metricValue) string(rv *reportValue) string {
+	return mv.format.string(rv.rt, rv.value)
+}
+
+// fullName is the metric's name, qualified by its labels if it has any.
+func (mv *metricValue) fullName() string {
+	if mv.labels == "" {
+		return mv.name
+	}
+	return mv.name + "{" + mv.labels + "}"
 }
 
+// A metricSetValue holds the values of a metric set at the end of an
+// interval.  It is shared by every Styler, so must not be modified.
 type metricSetValue struct {
-	metrics []metricValue
+	rtype        reflect.Type // The metric struct type
+	time         time.Time
+	iterDuration time.Duration
+	cumDuration  time.Duration
+	metrics      []metricValue
+}
+
+// layout describes the metrics and reports in msv, for noticing when new
+// series have appeared and headers need to be printed again.
+func (msv *metricSetValue) layout() string {
+	var buf strings.Builder
+	for i := range msv.metrics {
+		mv := msv.metrics[i]
+		buf.WriteString(mv.fullName())
+		for j := range mv.reports {
+			buf.WriteString(" ")
+			buf.WriteString(mv.reports[j].name)
+		}
+		buf.WriteString("\n")
+	}
+	return buf.String()
+}
+
+// getLayout returns the metrics and reports that getValues would return
+// right now, without their values.
+func (mst *metricSetType) getLayout() (msv *metricSetValue) {
+	return mst.collect(func(report reportType) float64 { return 0 }, false)
 }
 
+// tickedReport is implemented by report types that need to know when each
+// interval ends, before their values are read.
+type tickedReport interface {
+	tick(iterDuration time.Duration)
+}
+
+// getValues returns the values of every report, and starts a new interval.
 func (mst *metricSetType) getValues(iterDuration time.Duration, cumDuration time.Duration) (msv *metricSetValue) {
-	msv = &metricSetValue{metrics: make([]metricValue, len(mst.metrics))}
+	return mst.collect(func(report reportType) float64 {
+		if tr, ok := report.(tickedReport); ok {
+			tr.tick(iterDuration)
+		}
+		return report.get(iterDuration, cumDuration)
+	}, true)
+}
+
+// start starts the first interval at startTime.
+func (mst *metricSetType) start(startTime time.Time) {
+	mst.lock.Lock()
+	defer mst.lock.Unlock()
+	mst.startTime = startTime
+	mst.lastTime = startTime
+}
+
+// tick ends the current interval at curTime, returning its values and
+// starting the next one.
+func (mst *metricSetType) tick(curTime time.Time) (msv *metricSetValue) {
+	mst.lock.Lock()
+	iterDuration := curTime.Sub(mst.lastTime)
+	cumDuration := curTime.Sub(mst.startTime)
+	mst.lastTime = curTime
+	mst.lock.Unlock()
+	msv = mst.getValues(iterDuration, cumDuration)
+	msv.time, msv.iterDuration, msv.cumDuration = curTime, iterDuration, cumDuration
+	return
+}
+
+// collect reads every report with get, then evaluates derived metrics over
+// the results.  If roll is set, a new interval is then started.
+func (mst *metricSetType) collect(get func(report reportType) float64, roll bool) (msv *metricSetValue) {
+	mst.lock.Lock()
+	defer mst.lock.Unlock()
+	values := make(map[*metricSeries][]float64)
 	for i := range mst.metrics {
 		metric := mst.metrics[i]
-		msv.metrics[i].name = metric.name
-		msv.metrics[i].reports = make([]reportValue, len(metric.reports))
-		for j := range metric.reports {
-			report := metric.reports[j]
-			msv.metrics[i].reports[j] = reportValue{name: report.name(), value: report.get(iterDuration, cumDuration)}
+		if metric.derived != nil {
+			continue
+		}
+		for j := range metric.series {
+			ms := metric.series[j]
+			vals := make([]float64, len(ms.reports))
+			for k := range ms.reports {
+				vals[k] = get(ms.reports[k]) * metric.format.scale
+			}
+			values[ms] = vals
+		}
+	}
+	for i := range mst.metrics {
+		if mst.metrics[i].derived != nil {
+			mst.metrics[i].derived.evaluate(mst.metrics[i], values)
+		}
+	}
+	msv = &metricSetValue{rtype: mst.rtype}
+	for i := range mst.metrics {
+		metric := mst.metrics[i]
+		for j := range metric.series {
+			ms := metric.series[j]
+			mv := metricValue{name: metric.name, named: metric.named, labels: ms.labels, format: metric.format, reports: make([]reportValue, len(ms.reports))}
+			if ms.iterHist != nil {
+				mv.iterHist, mv.cumHist = ms.iterHist.clone(), ms.cumHist.clone()
+			}
+			if roll {
+				ms.iterSum = 0
+				for k := range ms.reports {
+					ms.reports[k].roll()
+				}
+				if ms.iterHist != nil {
+					ms.iterHist.reset()
+				}
+			}
+			for k := range ms.reports {
+				report := ms.reports[k]
+				mv.reports[k] = reportValue{name: report.name(), value: values[ms][k], rt: report}
+			}
+			msv.metrics = append(msv.metrics, mv)
 		}
 	}
 	return
@@ -145,3 +145,128 @@ func BenchmarkPlainIncrements(b *testing.B) {
 		metric.FloatVal += float64(i) * 0.1
 	}
 }
+
+type LabeledMetric struct {
+	Op      string `label:"op"`
+	Shard   int    `label:"shard"`
+	Count   int    `type:"counter" report:"total"`
+	Latency int    `type:"latency" report:"c50"`
+}
+
+func TestLabels(t *testing.T) {
+	mst, err := newMetricSetTypeOf(LabeledMetric{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msv := mst.getLayout(); len(msv.metrics) != 0 {
+		t.Error("expected no series before any labels are seen, got", len(msv.metrics))
+	}
+	mst.update(LabeledMetric{"insert", 0, 1, 10})
+	mst.update(LabeledMetric{"query", 1, 2, 20})
+	mst.update(&LabeledMetric{"insert", 0, 3, 10})
+	msv := mst.getValues(time.Second, time.Second)
+	expected := "Count{op=insert,shard=0} total\nCount{op=query,shard=1} total\nLatency{op=insert,shard=0} c50\nLatency{op=query,shard=1} c50\n"
+	if layout := msv.layout(); layout != expected {
+		t.Errorf("expected layout %q, got %q", expected, layout)
+	}
+	if msv.metrics[0].reports[0].value != 4 || msv.metrics[1].reports[0].value != 2 {
+		t.Error("expected per-label totals 4 and 2, got", msv.metrics[0].reports[0].value, msv.metrics[1].reports[0].value)
+	}
+	if msv.metrics[2].reports[0].value != 10 || msv.metrics[3].reports[0].value != 20 {
+		t.Error("expected per-label latencies 10 and 20, got", msv.metrics[2].reports[0].value, msv.metrics[3].reports[0].value)
+	}
+}
+
+type MapMetric struct {
+	Plain   int            `type:"counter" report:"total"`
+	Inserts map[int]int    `type:"counter" report:"total" label:"shard"`
+	Errors  map[string]int `type:"counter" report:"total"`
+}
+
+func TestMapLabels(t *testing.T) {
+	mst, err := newMetricSetTypeOf(MapMetric{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if layout := mst.getLayout().layout(); layout != "Plain total\n" {
+		t.Errorf("expected only the plain series before any data, got %q", layout)
+	}
+	mst.update(MapMetric{1, map[int]int{10: 6, 2: 5, 1: 3}, nil})
+	mst.update(MapMetric{1, map[int]int{1: 1}, map[string]int{"timeout": 7}})
+	msv := mst.getValues(time.Second, time.Second)
+	expected := "Plain total\nInserts{shard=1} total\nInserts{shard=2} total\nInserts{shard=10} total\nErrors{timeout} total\n"
+	if layout := msv.layout(); layout != expected {
+		t.Errorf("expected layout %q, got %q", expected, layout)
+	}
+	for i, v := range []float64{2, 4, 5, 6, 7} {
+		if msv.metrics[i].reports[0].value != v {
+			t.Error("expected", v, "for", msv.metrics[i].fullName(), "got", msv.metrics[i].reports[0].value)
+		}
+	}
+}
+
+func TestInvalidLabel(t *testing.T) {
+	type badLabel struct {
+		Op    float64 `label:"op"`
+		Count int     `type:"counter" report:"total"`
+	}
+	if _, err := newMetricSetTypeOf(badLabel{}); err == nil {
+		t.Error("expected an error for a float label")
+	}
+}
+
+type DiskMetric struct {
+	Reads  int `type:"counter" report:"total"`
+	Writes int `type:"counter" report:"total"`
+}
+
+type BaseMetric struct {
+	Ops int `type:"counter" report:"total"`
+}
+
+type NestedMetric struct {
+	BaseMetric
+	Disk    DiskMetric
+	Skipped int `type:"counter" report:"total" olbermann:"-"`
+	Comment string
+	helper  int
+}
+
+func TestNested(t *testing.T) {
+	mst, err := newMetricSetTypeOf(NestedMetric{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mst.update(NestedMetric{BaseMetric{1}, DiskMetric{2, 3}, 4, "ignored", 5})
+	mst.update(&NestedMetric{BaseMetric{1}, DiskMetric{2, 3}, 4, "ignored", 5})
+	msv := mst.getValues(time.Second, time.Second)
+	expected := "Ops total\nDisk.Reads total\nDisk.Writes total\n"
+	if layout := msv.layout(); layout != expected {
+		t.Errorf("expected layout %q, got %q", expected, layout)
+	}
+	for i, v := range []float64{2, 4, 6} {
+		if msv.metrics[i].reports[0].value != v {
+			t.Error("expected", v, "for", msv.metrics[i].fullName(), "got", msv.metrics[i].reports[0].value)
+		}
+	}
+}
+
+type ewmaMetric struct {
+	Ops int `type:"counter" report:"ewma1"`
+}
+
+func TestEwma(t *testing.T) {
+	mst, err := newMetricSetTypeOf(ewmaMetric{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Each interval's rate counts once per second it lasted, so the
+	// average is warmed up after ten seconds however long the intervals are.
+	for i := 0; i < 6; i++ {
+		mst.update(ewmaMetric{20})
+		msv := mst.getValues(2*time.Second, time.Duration(i+1)*2*time.Second)
+		if v := msv.metrics[0].reports[0].value; i == 5 && v != 10 {
+			t.Error("expected 10/s for Ops ewma1, got", v)
+		}
+	}
+}
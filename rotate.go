@@ -0,0 +1,207 @@
+package olbermann
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Compressor compresses a RotatingFile's segments once they are closed.
+// Gzip is built in; others can be plugged in without olbermann depending
+// on them, such as zstd:
+// 	zstd := &olbermann.Compressor{Ext: ".zst", NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+// 		return zstd.NewWriter(w)
+// 	}}
+type Compressor struct {
+	Ext       string                                    // Added to the names of compressed segments
+	NewWriter func(w io.Writer) (io.WriteCloser, error) // Returns a writer compressing to w
+}
+
+// Gzip compresses segments with gzip.
+var Gzip = &Compressor{Ext: ".gz", NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriter(w), nil
+}}
+
+// A RotatingFile is a Writer for Stylers that splits what they write
+// across a series of files, for runs too long to keep in one.  Each
+// segment is named after Path with its number added before the extension,
+// as in "soak-0001.csv", carrying on from any segments already there.
+//
+// A new segment is started once the current one holds MaxSize bytes or has
+// been open MaxAge, at the end of a line, so no row is split.  Stylers that
+// print headers, CsvStyler and DstatStyler, tell the RotatingFile which
+// lines are their headers, and it starts each segment with the latest, so
+// every segment can be read on its own.  Closed segments are compressed
+// with Compress in the background.
+//
+// Usage:
+// 	out := &olbermann.RotatingFile{Path: "soak.csv", MaxSize: 64 << 20, MaxAge: time.Hour, Compress: olbermann.Gzip}
+// 	defer out.Close()
+// 	if err := r.Start(ReportableMetric{}, &olbermann.CsvStyler{Period: time.Second, Writer: out}); err != nil {
+// 		return err
+// 	}
+type RotatingFile struct {
+	Path     string        // Where to write, with each segment's number added
+	MaxSize  int64         // Start a new segment after this many bytes, if positive
+	MaxAge   time.Duration // Start a new segment after this long, if positive
+	Compress *Compressor   // How to compress closed segments, if at all
+	lock     sync.Mutex
+	file     *os.File
+	size     int64
+	opened   time.Time
+	n        int
+	header   []byte
+	err      error // The first error compressing a segment
+	wg       sync.WaitGroup
+}
+
+// A headerWriter is a Writer that wants to know which lines are headers.
+type headerWriter interface {
+	writeHeader(p []byte) error
+}
+
+// segmentPath is the name of the nth segment.
+func (f *RotatingFile) segmentPath(n int) string {
+	ext := filepath.Ext(f.Path)
+	return fmt.Sprintf("%s-%04d%s", strings.TrimSuffix(f.Path, ext), n, ext)
+}
+
+// exists reports whether there's a file at path.
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// open starts the next segment, with the header.
+func (f *RotatingFile) open() (err error) {
+	for {
+		f.n++
+		path := f.segmentPath(f.n)
+		if f.Compress != nil && exists(path+f.Compress.Ext) {
+			continue
+		}
+		f.file, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return
+		}
+		break
+	}
+	f.size, f.opened = 0, time.Now()
+	if len(f.header) > 0 {
+		err = f.write(f.header)
+	}
+	return
+}
+
+// write writes p to the current segment.
+func (f *RotatingFile) write(p []byte) (err error) {
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return
+}
+
+// rotate closes the current segment and compresses it in the background.
+// The next is opened when something is written to it.
+func (f *RotatingFile) rotate() (err error) {
+	path := f.file.Name()
+	err = f.file.Close()
+	f.file = nil
+	if err == nil && f.Compress != nil {
+		f.wg.Add(1)
+		go func() {
+			defer f.wg.Done()
+			if err := compressFile(path, f.Compress); err != nil {
+				f.lock.Lock()
+				if f.err == nil {
+					f.err = err
+				}
+				f.lock.Unlock()
+			}
+		}()
+	}
+	return
+}
+
+// compressFile compresses the file at path with c, removing the original
+// once it has been.
+func compressFile(path string, c *Compressor) (err error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(path+c.Ext, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return
+	}
+	cw, err := c.NewWriter(dst)
+	if err == nil {
+		if _, err = io.Copy(cw, src); err == nil {
+			err = cw.Close()
+		}
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path + c.Ext)
+		return
+	}
+	return os.Remove(path)
+}
+
+// Write writes p to the current segment, and starts a new one if p ends a
+// line and the current segment is full or old enough.
+func (f *RotatingFile) Write(p []byte) (n int, err error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.file == nil {
+		if err = f.open(); err != nil {
+			return
+		}
+	}
+	if err = f.write(p); err != nil {
+		return
+	}
+	n = len(p)
+	if len(p) > 0 && p[len(p)-1] == '\n' &&
+		(f.MaxSize > 0 && f.size >= f.MaxSize || f.MaxAge > 0 && time.Since(f.opened) >= f.MaxAge) {
+		err = f.rotate()
+	}
+	return
+}
+
+// writeHeader remembers p as the header to start segments with, and writes
+// it.
+func (f *RotatingFile) writeHeader(p []byte) (err error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.header = append([]byte(nil), p...)
+	if f.file == nil {
+		return f.open()
+	}
+	return f.write(p)
+}
+
+// Close closes the current segment and waits for every segment to be
+// compressed.
+func (f *RotatingFile) Close() (err error) {
+	f.lock.Lock()
+	if f.file != nil {
+		err = f.rotate()
+	}
+	f.lock.Unlock()
+	f.wg.Wait()
+	if err == nil {
+		err = f.err
+	}
+	return
+}
@@ -0,0 +1,104 @@
+package olbermann
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotatingFile(t *testing.T) {
+	dir := t.TempDir()
+	out := &RotatingFile{Path: filepath.Join(dir, "soak.csv"), MaxSize: 200, Compress: Gzip}
+	r := &Reporter{}
+	tr := startTestRun(t, r, csvMetric{}, &CsvStyler{Writer: out})
+	for i := 1; i <= 10; i++ {
+		tr.interval(csvMetric{Ops: 1})
+	}
+	r.Close()
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+	segments, _ := filepath.Glob(filepath.Join(dir, "*"))
+	if len(segments) < 3 {
+		t.Fatal("expected several segments, got", segments)
+	}
+	rows := 0
+	for i, path := range segments {
+		if expected := out.segmentPath(i+1) + ".gz"; path != expected {
+			t.Fatalf("expected segment %s, got %s", expected, path)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		run, err := ReadRun(f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("expected %s to read on its own, got %v", path, err)
+		}
+		if len(run.Columns) != 3 {
+			t.Error("expected every segment to have the header, got", run.Columns)
+		}
+		rows += len(run.Rows)
+	}
+	if rows != 10 {
+		t.Error("expected all 10 rows across the segments, got", rows)
+	}
+
+	// Carry on from the segments already there.
+	out = &RotatingFile{Path: filepath.Join(dir, "soak.csv"), Compress: Gzip}
+	io.WriteString(out, "more\n")
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(out.segmentPath(len(segments)+1) + ".gz"); err != nil {
+		t.Error("expected a new segment after the old ones, got", err)
+	}
+}
+
+func TestRotatingFileDstat(t *testing.T) {
+	dir := t.TempDir()
+	out := &RotatingFile{Path: filepath.Join(dir, "soak.log"), MaxAge: time.Nanosecond}
+	s := &DstatStyler{LinesBetweenHeaders: 100, Logger: log.New(out, "", 0)}
+	r := &Reporter{}
+	tr := startTestRun(t, r, csvMetric{}, s)
+	for i := 1; i <= 2; i++ {
+		tr.interval(csvMetric{Ops: 1})
+	}
+	r.Close()
+	out.Close()
+	first, _ := os.ReadFile(out.segmentPath(1))
+	second, _ := os.ReadFile(out.segmentPath(2))
+	if lines := strings.Split(string(second), "\n"); len(lines) != 4 || !bytes.HasPrefix(first, []byte(strings.Join(lines[:2], "\n"))) {
+		t.Errorf("expected the second segment to start with the header, got\n%s\nafter\n%s", second, first)
+	}
+}
+
+func TestCompressFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "segment.csv")
+	os.WriteFile(path, []byte("time,x\n"), 0666)
+	if err := compressFile(path, Gzip); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("expected the original to be removed, got", err)
+	}
+	f, err := os.Open(path + ".gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := io.ReadAll(zr); string(b) != "time,x\n" {
+		t.Errorf("expected the segment back, got %q", b)
+	}
+}
@@ -0,0 +1,535 @@
+package olbermann
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// A Run is a table of reported values read back from a file, such as
+// CsvStyler's output, for looking at a run after the fact.
+//
+// Each row holds the values reported at the end of one interval.  Each
+// column is one report of one metric series, named as CsvStyler names it,
+// e.g. "Latency{op=get} w99".  Series that appeared partway through the
+// run have NaN in the rows before they did.
+//
+// A Run collected by a Styler started for several metric sets names each
+// column after its set too, e.g. "main.OpMetric Latency{op=get} w99", so
+// that metrics of the same name in different sets are kept apart.
+type Run struct {
+	Columns    []string
+	Times      []time.Time
+	Rows       [][]float64 // Rows[i][j] is the value of Columns[j] at Times[i]
+	indexes    map[string]int
+	sets       []reflect.Type // The metric sets values were appended from
+	columnSets []reflect.Type // The metric set of each column appended
+	formats    []columnFormat // How each column appended is formatted
+}
+
+// A columnFormat is how the values of a column appended from a metric set
+// are printed.  Runs read back from files don't keep their formats.
+type columnFormat struct {
+	format *valueFormat
+	rt     reportType
+}
+
+// ReadRun reads a Run written by CsvStyler, or converted to JSON by
+// Run.MarshalJSON, telling which from the first character.  Several JSON
+// objects one after another, as "olbermann json" writes for several files,
+// are read as one Run, as several CSV headers are.  Runs compressed with
+// gzip, such as RotatingFile's segments, are decompressed first.
+func ReadRun(rd io.Reader) (run *Run, err error) {
+	br := bufio.NewReader(rd)
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		var zr *gzip.Reader
+		if zr, err = gzip.NewReader(br); err != nil {
+			return
+		}
+		defer zr.Close()
+		br = bufio.NewReader(zr)
+	}
+	for {
+		var c rune
+		if c, _, err = br.ReadRune(); err != nil {
+			if err == io.EOF {
+				err = errors.New("olbermann: empty run")
+			}
+			return
+		}
+		if !strings.ContainsRune(" \t\r\n", c) {
+			br.UnreadRune()
+			if c == '{' {
+				return readJSON(br)
+			}
+			return ReadCsv(br)
+		}
+	}
+}
+
+// readJSON reads every Run in rd, written by MarshalJSON one after another,
+// as one Run.
+func readJSON(rd io.Reader) (run *Run, err error) {
+	dec := json.NewDecoder(rd)
+	for {
+		var next Run
+		if err = dec.Decode(&next); err == io.EOF {
+			return run, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if run == nil {
+			run = &next
+		} else {
+			run.appendRun(&next)
+		}
+	}
+}
+
+// appendRun adds other's rows to the Run, adding columns for any that are
+// new.
+func (run *Run) appendRun(other *Run) {
+	indexes := make(map[string]int)
+	for j := range run.Columns {
+		indexes[run.Columns[j]] = j
+	}
+	header := make([]int, len(other.Columns))
+	for i, col := range other.Columns {
+		j, ok := indexes[col]
+		if !ok {
+			j = len(run.Columns)
+			indexes[col] = j
+			run.Columns = append(run.Columns, col)
+		}
+		header[i] = j
+	}
+	run.pad()
+	for i := range other.Rows {
+		row := make([]float64, len(run.Columns))
+		for j := range row {
+			row[j] = math.NaN()
+		}
+		for k, v := range other.Rows[i] {
+			row[header[k]] = v
+		}
+		run.Times = append(run.Times, other.Times[i])
+		run.Rows = append(run.Rows, row)
+	}
+}
+
+// runTimeLayouts are the ways times are written in a Run's rows.
+var runTimeLayouts = []string{
+	"2006-01-02 15:04:05.999999999 -0700 MST", // time.Time.String
+	time.RFC3339Nano,
+}
+
+// parseRunTime parses the time of a row of a Run, written in one of the
+// runTimeLayouts or as seconds since the Unix epoch.
+func parseRunTime(s string) (t time.Time, err error) {
+	// Drop the monotonic clock reading time.Time.String adds.
+	if i := strings.Index(s, " m="); i >= 0 {
+		s = s[:i]
+	}
+	for i := range runTimeLayouts {
+		if t, err = time.Parse(runTimeLayouts[i], s); err == nil {
+			return
+		}
+	}
+	if secs, perr := strconv.ParseFloat(s, 64); perr == nil {
+		return unixTime(secs), nil
+	}
+	err = errors.New("olbermann: can't parse time " + strconv.Quote(s))
+	return
+}
+
+// unixTime is secs seconds after the Unix epoch.
+func unixTime(secs float64) time.Time {
+	whole := math.Floor(secs)
+	return time.Unix(int64(whole), int64(math.Round((secs-whole)*1e9)))
+}
+
+// runTimeColumns name the first column of CsvStyler's headers.
+var runTimeColumns = []string{"time", "elapsed"}
+
+// runExtraColumns are columns CsvStyler may write that aren't values.
+var runExtraColumns = map[string]bool{"seq": true, "interval": true}
+
+// csvComma finds the delimiter of CsvStyler's output, the character after
+// the first header's first column.
+func csvComma(br *bufio.Reader) rune {
+	for _, col := range runTimeColumns {
+		if b, err := br.Peek(len(col) + 1); err == nil && string(b[:len(col)]) == col && b[len(col)] < utf8.RuneSelf {
+			return rune(b[len(col)])
+		}
+	}
+	return ','
+}
+
+// ReadCsv reads a Run from CsvStyler's output, with any delimiter and time
+// format.  Headers may appear again partway through, with columns for new
+// series.  Times written as seconds elapsed are read as that long after
+// the zero time.
+func ReadCsv(rd io.Reader) (run *Run, err error) {
+	br := bufio.NewReader(rd)
+	cr := csv.NewReader(br)
+	cr.Comma = csvComma(br)
+	cr.FieldsPerRecord = -1
+	run = &Run{}
+	indexes := make(map[string]int)
+	var header []int // Indexes of the columns, or -1 for those to skip
+	elapsed := false
+	for line := 1; ; line++ {
+		var record []string
+		if record, err = cr.Read(); err == io.EOF {
+			err = nil
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if record[0] == "time" || record[0] == "elapsed" {
+			elapsed = record[0] == "elapsed"
+			header = make([]int, len(record)-1)
+			for i, col := range record[1:] {
+				if runExtraColumns[col] {
+					header[i] = -1
+					continue
+				}
+				j, ok := indexes[col]
+				if !ok {
+					j = len(run.Columns)
+					indexes[col] = j
+					run.Columns = append(run.Columns, col)
+				}
+				header[i] = j
+			}
+			continue
+		}
+		if header == nil {
+			return nil, fmt.Errorf("olbermann: line %d: values before the header", line)
+		}
+		if len(record)-1 != len(header) {
+			return nil, fmt.Errorf("olbermann: line %d: %d values for %d columns", line, len(record)-1, len(header))
+		}
+		var t time.Time
+		if elapsed {
+			var secs float64
+			if secs, err = strconv.ParseFloat(record[0], 64); err != nil {
+				return nil, fmt.Errorf("olbermann: line %d: bad elapsed time: %v", line, err)
+			}
+			t = time.Time{}.Add(time.Duration(secs * float64(time.Second)))
+		} else if t, err = parseRunTime(record[0]); err != nil {
+			return nil, fmt.Errorf("olbermann: line %d: %v", line, err)
+		}
+		row := make([]float64, len(run.Columns))
+		for i := range row {
+			row[i] = math.NaN()
+		}
+		for i, s := range record[1:] {
+			if s == "" || header[i] < 0 {
+				continue
+			}
+			if row[header[i]], err = strconv.ParseFloat(s, 64); err != nil {
+				return nil, fmt.Errorf("olbermann: line %d: bad value for %s: %v", line, run.Columns[header[i]], err)
+			}
+		}
+		run.Times = append(run.Times, t)
+		run.Rows = append(run.Rows, row)
+	}
+	run.pad()
+	return
+}
+
+// pad fills out rows read before later columns appeared with NaN.
+func (run *Run) pad() {
+	for i := range run.Rows {
+		for len(run.Rows[i]) < len(run.Columns) {
+			run.Rows[i] = append(run.Rows[i], math.NaN())
+		}
+	}
+}
+
+// addSet notes that values of rtype are being appended.  When a second set
+// shows up, the columns of the first are renamed after it.
+func (run *Run) addSet(rtype reflect.Type) {
+	for _, set := range run.sets {
+		if set == rtype {
+			return
+		}
+	}
+	run.sets = append(run.sets, rtype)
+	if len(run.sets) != 2 {
+		return
+	}
+	run.indexes = nil
+	for j := range run.columnSets {
+		run.Columns[j] = run.columnSets[j].String() + " " + run.Columns[j]
+	}
+}
+
+// appendValues adds a row of msv's values to the Run, adding columns for
+// any series that are new.  Values of another metric set at the same time
+// as the last row are added to it instead.
+func (run *Run) appendValues(msv *metricSetValue) {
+	run.addSet(msv.rtype)
+	if run.indexes == nil {
+		run.indexes = make(map[string]int)
+		for j := range run.Columns {
+			run.indexes[run.Columns[j]] = j
+		}
+	}
+	var row []float64
+	if n := len(run.Rows); n > 0 && run.Times[n-1].Equal(msv.time) {
+		row = run.Rows[n-1]
+		run.Times, run.Rows = run.Times[:n-1], run.Rows[:n-1]
+	} else {
+		row = make([]float64, len(run.Columns))
+		for i := range row {
+			row[i] = math.NaN()
+		}
+	}
+	for i := range msv.metrics {
+		mv := &msv.metrics[i]
+		for k := range mv.reports {
+			col := mv.fullName() + " " + mv.reports[k].name
+			if len(run.sets) > 1 {
+				col = msv.rtype.String() + " " + col
+			}
+			j, ok := run.indexes[col]
+			if !ok {
+				j = len(run.Columns)
+				run.indexes[col] = j
+				run.Columns = append(run.Columns, col)
+				run.columnSets = append(run.columnSets, msv.rtype)
+				run.formats = append(run.formats, columnFormat{mv.format, mv.reports[k].rt})
+				row = append(row, math.NaN())
+			}
+			row[j] = mv.reports[k].value
+		}
+	}
+	run.Times = append(run.Times, msv.time)
+	run.Rows = append(run.Rows, row)
+	run.pad()
+}
+
+type jsonRun struct {
+	Columns []string  `json:"columns"`
+	Rows    []jsonRow `json:"rows"`
+}
+
+type jsonRow struct {
+	Time   time.Time  `json:"time"`
+	Values []*float64 `json:"values"` // null where NaN
+}
+
+// MarshalJSON writes the Run as an object with a list of "columns" and a
+// list of "rows", each with its "time" and a list of "values", with null
+// for values that weren't reported.
+func (run *Run) MarshalJSON() ([]byte, error) {
+	jr := jsonRun{Columns: run.Columns, Rows: make([]jsonRow, len(run.Rows))}
+	for i := range run.Rows {
+		jr.Rows[i] = jsonRow{Time: run.Times[i], Values: make([]*float64, len(run.Rows[i]))}
+		for j := range run.Rows[i] {
+			if !math.IsNaN(run.Rows[i][j]) {
+				jr.Rows[i].Values[j] = &run.Rows[i][j]
+			}
+		}
+	}
+	return json.Marshal(&jr)
+}
+
+// UnmarshalJSON reads a Run written by MarshalJSON.
+func (run *Run) UnmarshalJSON(data []byte) (err error) {
+	var jr jsonRun
+	if err = json.Unmarshal(data, &jr); err != nil {
+		return
+	}
+	*run = Run{Columns: jr.Columns}
+	for i := range jr.Rows {
+		if len(jr.Rows[i].Values) > len(jr.Columns) {
+			return fmt.Errorf("olbermann: row %d: %d values for %d columns", i, len(jr.Rows[i].Values), len(jr.Columns))
+		}
+		row := make([]float64, len(jr.Rows[i].Values))
+		for j, v := range jr.Rows[i].Values {
+			row[j] = math.NaN()
+			if v != nil {
+				row[j] = *v
+			}
+		}
+		run.Times = append(run.Times, jr.Rows[i].Time)
+		run.Rows = append(run.Rows, row)
+	}
+	run.pad()
+	return
+}
+
+// formatValue formats a value of column j with its metric's unit and
+// format, or with plain if it has neither or they weren't kept.
+func (run *Run) formatValue(j int, val float64, plain func(float64) string) string {
+	if j < len(run.formats) {
+		return run.formats[j].format.tagged(run.formats[j].rt, val, plain)
+	}
+	return plain(val)
+}
+
+// Window returns the part of the Run from from to to after its first row,
+// for leaving out warmup and wind-down.  A to of zero or less means the
+// end of the Run.
+func (run *Run) Window(from time.Duration, to time.Duration) (res *Run) {
+	res = &Run{Columns: run.Columns, formats: run.formats}
+	if len(run.Times) == 0 {
+		return
+	}
+	start := run.Times[0]
+	for i := range run.Times {
+		elapsed := run.Times[i].Sub(start)
+		if elapsed < from || to > 0 && elapsed > to {
+			continue
+		}
+		res.Times = append(res.Times, run.Times[i])
+		res.Rows = append(res.Rows, run.Rows[i])
+	}
+	return
+}
+
+// Column returns the values reported for a column, leaving out the rows
+// it wasn't reported in, or nil if the Run has no such column.
+func (run *Run) Column(name string) (values []float64) {
+	for j := range run.Columns {
+		if run.Columns[j] != name {
+			continue
+		}
+		for i := range run.Rows {
+			if !math.IsNaN(run.Rows[i][j]) {
+				values = append(values, run.Rows[i][j])
+			}
+		}
+	}
+	return
+}
+
+// A ColumnSummary describes the values of one column of a Run.
+type ColumnSummary struct {
+	Column string
+	N      int // How many rows had a value
+	Min    float64
+	Mean   float64
+	Max    float64
+	Stddev float64 // The sample standard deviation
+}
+
+// Summarize describes each column of the Run.
+func (run *Run) Summarize() (summaries []ColumnSummary) {
+	summaries = make([]ColumnSummary, len(run.Columns))
+	for j := range run.Columns {
+		summaries[j] = summarize(run.Columns[j], run.Column(run.Columns[j]))
+	}
+	return
+}
+
+func summarize(column string, values []float64) (s ColumnSummary) {
+	s = ColumnSummary{Column: column, N: len(values), Min: math.NaN(), Mean: math.NaN(), Max: math.NaN(), Stddev: math.NaN()}
+	if len(values) == 0 {
+		return
+	}
+	s.Min, s.Max = values[0], values[0]
+	var sum float64
+	for _, v := range values {
+		s.Min = math.Min(s.Min, v)
+		s.Max = math.Max(s.Max, v)
+		sum += v
+	}
+	s.Mean = sum / float64(len(values))
+	if len(values) > 1 {
+		var squares float64
+		for _, v := range values {
+			squares += (v - s.Mean) * (v - s.Mean)
+		}
+		s.Stddev = math.Sqrt(squares / float64(len(values)-1))
+	}
+	return
+}
+
+// A loadedReportType stands in for the report type of values read back
+// from a file, which are only printed.
+type loadedReportType struct {
+	nameString string
+}
+
+func (t *loadedReportType) name() string {
+	return t.nameString
+}
+
+func (t *loadedReportType) add(fval reflect.Value) {}
+
+func (t *loadedReportType) get(iterDuration time.Duration, cumDuration time.Duration) float64 {
+	return 0
+}
+
+func (t *loadedReportType) roll() {}
+
+func (t *loadedReportType) close() {}
+
+func (t *loadedReportType) string(val float64) string {
+	if val == math.Trunc(val) && math.Abs(val) < 1e15 {
+		return fmt.Sprintf("%d", int64(val))
+	}
+	return fmt.Sprintf("%.2f", val)
+}
+
+// splitColumn splits a column's name into its metric's name, labels and
+// report.
+func splitColumn(column string) (name string, labels string, report string) {
+	name = column
+	if i := strings.LastIndex(column, " "); i >= 0 {
+		name, report = column[:i], column[i+1:]
+	}
+	if i := strings.Index(name, "{"); i >= 0 && strings.HasSuffix(name, "}") {
+		name, labels = name[:i], name[i+1:len(name)-1]
+	}
+	return
+}
+
+// Render prints the Run with a Styler, a row at a time, as if it were
+// being reported again.  Units and formats aren't kept in a Run, so
+// values are printed plainly.
+func (run *Run) Render(styler Styler) {
+	sub := &subscription{styler: styler}
+	format := &valueFormat{scale: 1}
+	// How long the first interval was isn't kept, so take it to be as long
+	// as the next.
+	var first time.Duration
+	if len(run.Times) > 1 {
+		first = run.Times[1].Sub(run.Times[0])
+	}
+	for i := range run.Rows {
+		msv := &metricSetValue{time: run.Times[i], iterDuration: first}
+		if i > 0 {
+			msv.iterDuration = run.Times[i].Sub(run.Times[i-1])
+		}
+		msv.cumDuration = run.Times[i].Sub(run.Times[0]) + first
+		var last string
+		for j := range run.Columns {
+			if math.IsNaN(run.Rows[i][j]) {
+				continue
+			}
+			name, labels, report := splitColumn(run.Columns[j])
+			if key := name + "{" + labels + "}"; key != last || len(msv.metrics) == 0 {
+				last = key
+				msv.metrics = append(msv.metrics, metricValue{name: name, labels: labels, format: format})
+			}
+			mv := &msv.metrics[len(msv.metrics)-1]
+			mv.reports = append(mv.reports, reportValue{name: report, value: run.Rows[i][j], rt: &loadedReportType{report}})
+		}
+		sub.print(msv)
+	}
+}
@@ -0,0 +1,125 @@
+package olbermann
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"log"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testCsv = `time,"Ops iter","Latency{op=get} w99"
+"2020-01-01 00:00:01 +0000 UTC m=+1.000000001",10.000000,5.000000
+"2020-01-01 00:00:02 +0000 UTC m=+2.000000001",20.000000,7.000000
+time,"Ops iter","Latency{op=get} w99","Latency{op=put} w99"
+"2020-01-01 00:00:03 +0000 UTC m=+3.000000001",30.000000,6.000000,9.000000
+`
+
+func TestReadCsv(t *testing.T) {
+	run, err := ReadRun(strings.NewReader(testCsv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(run.Columns) != 3 || run.Columns[2] != "Latency{op=put} w99" {
+		t.Fatal("unexpected columns", run.Columns)
+	}
+	if len(run.Rows) != 3 || !run.Times[2].Equal(time.Date(2020, 1, 1, 0, 0, 3, 0, time.UTC)) {
+		t.Fatal("unexpected rows", run.Times, run.Rows)
+	}
+	if !math.IsNaN(run.Rows[0][2]) || run.Rows[2][2] != 9 {
+		t.Error("expected a new column to be NaN until it appears, got", run.Rows)
+	}
+	if _, err := ReadCsv(strings.NewReader("\"2020-01-01 00:00:01 +0000 UTC\",1\n")); err == nil {
+		t.Error("expected an error for values before the header")
+	}
+}
+
+func TestRunSummary(t *testing.T) {
+	run, err := ReadCsv(strings.NewReader(testCsv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := run.Summarize()
+	if s[0].N != 3 || s[0].Min != 10 || s[0].Mean != 20 || s[0].Max != 30 || s[0].Stddev != 10 {
+		t.Error("unexpected summary", s[0])
+	}
+	if s[2].N != 1 || s[2].Mean != 9 || !math.IsNaN(s[2].Stddev) {
+		t.Error("unexpected summary", s[2])
+	}
+	window := run.Window(time.Second, 0)
+	if len(window.Rows) != 2 || window.Rows[0][0] != 20 {
+		t.Error("expected to leave out the first second, got", window.Rows)
+	}
+	if window = run.Window(0, time.Second); len(window.Rows) != 2 || window.Rows[1][0] != 20 {
+		t.Error("expected to leave out the last second, got", window.Rows)
+	}
+}
+
+func TestRunJSON(t *testing.T) {
+	run, err := ReadCsv(strings.NewReader(testCsv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"values":[10,5,null]`) {
+		t.Error("expected null for missing values, got", string(data))
+	}
+	again, err := ReadRun(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again.Rows) != 3 || !math.IsNaN(again.Rows[0][2]) || again.Rows[2][2] != 9 || !again.Times[0].Equal(run.Times[0]) {
+		t.Error("expected the same run back from JSON, got", again)
+	}
+
+	// As "olbermann json" writes several files.
+	other, _ := json.Marshal(&Run{Columns: []string{"Ops iter", "Reads iter"}, Times: []time.Time{run.Times[2].Add(time.Second)}, Rows: [][]float64{{40, 1}}})
+	both, err := ReadRun(strings.NewReader(string(data) + "\n" + string(other) + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(both.Columns) != 4 || len(both.Rows) != 4 || both.Rows[3][0] != 40 || both.Rows[3][3] != 1 || !math.IsNaN(both.Rows[0][3]) || !math.IsNaN(both.Rows[3][1]) {
+		t.Error("expected the runs read one after the other, got", both.Columns, both.Rows)
+	}
+}
+
+func TestRunRender(t *testing.T) {
+	run, err := ReadCsv(strings.NewReader(testCsv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	run.Render(&DstatStyler{Logger: log.New(&buf, "", 0), TimeFormat: "15:04:05"})
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 7 {
+		t.Fatalf("expected headers again when the put series appears, got\n%s", buf.String())
+	}
+	if !strings.Contains(lines[0], "latency{op=get}") || !strings.HasPrefix(lines[2], "00:00:01 ") || !strings.Contains(lines[2], " 10 ") {
+		t.Errorf("unexpected output\n%s", buf.String())
+	}
+	if len(lines[1]) != len(lines[2]) {
+		t.Errorf("expected headers to line up with values\n%s", buf.String())
+	}
+
+	var out bytes.Buffer
+	run.Render(&CsvStyler{Writer: bufio.NewWriter(&out)})
+	again, err := ReadCsv(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again.Rows) != 3 || again.Rows[2][2] != 9 {
+		t.Error("expected rendering as CSV to give the same run back, got", again.Rows)
+	}
+
+	out.Reset()
+	run.Render(&CsvStyler{Writer: &out, TimeFormat: CsvElapsed, Precision: CsvShortest, Interval: true})
+	if lines := strings.Split(out.String(), "\n"); !strings.HasPrefix(lines[1], "1,1,") || !strings.HasPrefix(lines[4], "3,1,") {
+		t.Errorf("expected each row a second on, with the first a second in, got\n%s", out.String())
+	}
+}
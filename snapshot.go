@@ -0,0 +1,89 @@
+package olbermann
+
+import (
+	"time"
+)
+
+// A Snapshot holds the value of every report of every metric a Reporter is
+// reporting, at one moment.  Metric sets started at different times cover
+// different spans, so each MetricSnapshot has its own; Interval and Elapsed
+// are those of the set that has been running longest.
+type Snapshot struct {
+	Time     time.Time     // When the snapshot was taken
+	Interval time.Duration // How much of the current interval the windowed and iter reports cover
+	Elapsed  time.Duration // How long reporting has been running, which cumulative reports cover
+	Metrics  []MetricSnapshot
+}
+
+// A MetricSnapshot holds the report values of one metric, or of one series
+// of a labeled metric.
+type MetricSnapshot struct {
+	Set      string        // The metric struct's type
+	Name     string        // The metric's name
+	Labels   string        // The series' labels, such as "op=insert,shard=1", or ""
+	Unit     string        // The unit from the metric's "unit" tag
+	Interval time.Duration // How much of the current interval the metric set's windowed and iter reports cover
+	Elapsed  time.Duration // How long the metric set has been reported, which its cumulative reports cover
+	Reports  []ReportSnapshot
+}
+
+// A ReportSnapshot holds one report's value.
+type ReportSnapshot struct {
+	Name  string
+	Value float64
+}
+
+// FullName is the metric's name, qualified by its labels if it has any, as
+// in "Latency{op=insert}".
+func (m *MetricSnapshot) FullName() string {
+	if m.Labels == "" {
+		return m.Name
+	}
+	return m.Name + "{" + m.Labels + "}"
+}
+
+// Value returns the value of a metric's report, looking the metric up by
+// Name or FullName.
+//
+// Usage:
+// 	if p99, ok := r.Snapshot().Value("Latency", "w99"); ok && p99 > 50 {
+// 		slowDown()
+// 	}
+func (s *Snapshot) Value(metric string, report string) (value float64, ok bool) {
+	for i := range s.Metrics {
+		m := &s.Metrics[i]
+		if m.Name != metric && m.FullName() != metric {
+			continue
+		}
+		for j := range m.Reports {
+			if m.Reports[j].Name == report {
+				return m.Reports[j].Value, true
+			}
+		}
+	}
+	return
+}
+
+func (msv *metricSetValue) appendSnapshot(set string, metrics []MetricSnapshot) []MetricSnapshot {
+	for i := range msv.metrics {
+		mv := msv.metrics[i]
+		ms := MetricSnapshot{Set: set, Name: mv.name, Labels: mv.labels, Unit: mv.format.unit, Interval: msv.iterDuration, Elapsed: msv.cumDuration, Reports: make([]ReportSnapshot, len(mv.reports))}
+		for j := range mv.reports {
+			ms.Reports[j] = ReportSnapshot{Name: mv.reports[j].name, Value: mv.reports[j].value}
+		}
+		metrics = append(metrics, ms)
+	}
+	return metrics
+}
+
+// Snapshot returns the values of every report of every metric being
+// reported, as of the end of the latest interval.  These are the same
+// values the Stylers printed for that interval; taking a snapshot doesn't
+// disturb them.  Before the first interval ends, the Snapshot is empty.
+//
+// The Snapshot is shared, so must not be modified.
+func (r *Reporter) Snapshot() Snapshot {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.latest
+}
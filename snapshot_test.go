@@ -0,0 +1,87 @@
+package olbermann
+
+import (
+	"io/ioutil"
+	"log"
+	"testing"
+	"time"
+)
+
+func TestSnapshot(t *testing.T) {
+	type snapshotMetric struct {
+		Op      string  `label:"op"`
+		Ops     int     `type:"counter" report:"iter,total"`
+		Latency float64 `type:"latency" report:"w50,c50" unit:"ms"`
+	}
+	c := make(chan interface{}, 3)
+	r := &Reporter{C: c}
+	if err := r.Start(snapshotMetric{}, &DstatStyler{Period: time.Second, Logger: log.New(ioutil.Discard, "", 0)}); err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	c <- snapshotMetric{"get", 2, 10}
+	c <- &snapshotMetric{"get", 3, 10}
+	c <- snapshotMetric{"put", 1, 20}
+	close(c)
+	r.Feed()
+	if s := r.Snapshot(); len(s.Metrics) != 0 {
+		t.Error("expected an empty snapshot before the first interval ends")
+	}
+	r.tick(time.Now())
+
+	for i := 0; i < 2; i++ {
+		s := r.Snapshot()
+		if s.Elapsed <= 0 || s.Interval <= 0 || s.Interval > s.Elapsed {
+			t.Error("unexpected durations", s.Interval, s.Elapsed)
+		}
+		if len(s.Metrics) != 4 {
+			t.Fatal("expected 4 metric series, got", len(s.Metrics))
+		}
+		if m := s.Metrics[0]; m.Set != "olbermann.snapshotMetric" || m.FullName() != "Ops{op=get}" {
+			t.Error("unexpected metric", m.Set, m.FullName())
+		}
+		if m := s.Metrics[3]; m.FullName() != "Latency{op=put}" || m.Unit != "ms" {
+			t.Error("unexpected metric", m.FullName(), m.Unit)
+		}
+		if v, ok := s.Value("Ops{op=get}", "total"); !ok || v != 5 {
+			t.Error("expected a total of 5 gets, got", v, ok)
+		}
+		// Taking a snapshot must not reset windowed reports.
+		if v, ok := s.Value("Latency{op=put}", "w50"); !ok || v != 20 {
+			t.Error("expected w50 of 20 for puts, got", v, ok)
+		}
+		if v, ok := s.Value("Ops", "total"); !ok || v != 5 {
+			t.Error("expected lookup by name to find the first series, got", v, ok)
+		}
+		if _, ok := s.Value("Ops", "c50"); ok {
+			t.Error("expected no c50 report for Ops")
+		}
+	}
+}
+
+type laterMetric struct {
+	Ops int `type:"counter" report:"total"`
+}
+
+func TestSnapshotDurations(t *testing.T) {
+	r := &Reporter{}
+	// Listed first, but started half a second after the other set.
+	later := startTestRun(t, r, laterMetric{}, &CsvStyler{Writer: ioutil.Discard})
+	tr := startTestRun(t, r, assertMetric{}, &CsvStyler{Writer: ioutil.Discard})
+	tr.mst.start(tr.start)
+	later.mst.start(tr.start.Add(500 * time.Millisecond))
+	defer r.Close()
+	for i := 0; i < 3; i++ {
+		later.mst.update(laterMetric{1})
+		tr.interval(assertMetric{"get", 1, 1})
+	}
+	s := r.Snapshot()
+	if s.Elapsed != 3*time.Second || s.Interval != time.Second {
+		t.Error("expected the durations of the longest-running set, got", s.Interval, s.Elapsed)
+	}
+	for _, m := range s.Metrics {
+		if m.Set == "olbermann.laterMetric" && m.Elapsed != 2500*time.Millisecond || m.Set == "olbermann.assertMetric" && m.Elapsed != 3*time.Second {
+			t.Errorf("expected each set's own elapsed time, got %v for %s", m.Elapsed, m.Set)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package olbermann
+
+import (
+	"os"
+	"strconv"
+)
+
+// isTerminal reports whether f is a terminal, rather than a file or pipe.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// terminalWidth is how many columns wide the terminal f is connected to
+// is, from the terminal itself or else $COLUMNS, or 80 if neither says.
+func terminalWidth(f *os.File) int {
+	if width, _ := ttySize(f); width > 0 {
+		return width
+	}
+	if width, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && width > 0 {
+		return width
+	}
+	return 80
+}
+
+// terminalHeight is how many lines tall the terminal f is connected to is,
+// from the terminal itself or else $LINES, or 24 if neither says.
+func terminalHeight(f *os.File) int {
+	if _, height := ttySize(f); height > 0 {
+		return height
+	}
+	if height, err := strconv.Atoi(os.Getenv("LINES")); err == nil && height > 0 {
+		return height
+	}
+	return 24
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package olbermann
+
+import (
+	"os"
+)
+
+// ttySize can't ask terminals how big they are on this platform.
+func ttySize(f *os.File) (width int, height int) {
+	return
+}
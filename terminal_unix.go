@@ -0,0 +1,22 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package olbermann
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// ttySize asks the terminal f is connected to how wide and tall it is, or
+// returns 0s if it can't tell.
+func ttySize(f *os.File) (width int, height int) {
+	var ws struct {
+		rows, cols, xpixels, ypixels uint16
+	}
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), uintptr(syscall.TIOCGWINSZ), uintptr(unsafe.Pointer(&ws))); errno != 0 {
+		return
+	}
+	return int(ws.cols), int(ws.rows)
+}
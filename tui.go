@@ -0,0 +1,348 @@
+package olbermann
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// ANSI escape sequences.
+const (
+	ansiHome       = "\x1b[H"
+	ansiClear      = "\x1b[2J"
+	ansiClearLine  = "\x1b[K"
+	ansiClearBelow = "\x1b[J"
+	ansiReset      = "\x1b[0m"
+	ansiBold       = "\x1b[1m"
+	ansiRed        = "\x1b[31m"
+	ansiYellow     = "\x1b[33m"
+	ansiCyan       = "\x1b[36m"
+	ansiAltScreen  = "\x1b[?1049h"
+	ansiMainScreen = "\x1b[?1049l"
+	ansiHideCursor = "\x1b[?25l"
+	ansiShowCursor = "\x1b[?25h"
+)
+
+// sparkBars are the bars of a sparkline, lowest first.
+var sparkBars = []rune("▁▂▃▄▅▆▇█")
+
+// TUIStyler is a Styler that keeps a full screen of the terminal up to
+// date, rather than scrolling.  Each report of each series gets a line
+// with its current value, the lowest and highest over the intervals it
+// remembers, and a sparkline of as many of the latest as fit the
+// terminal's width, with the lowest marked in cyan and the highest in
+// yellow.  Values that breach one
+// of the Thresholds are shown in red, as is the latest alert.  Start fails
+// if any of them doesn't parse.  Lines that don't fit the terminal's height
+// are left out.
+//
+// TUIStyler draws on the terminal's alternate screen, with the cursor
+// hidden, and puts the terminal back as it was at Close, before printing
+// the final report.
+//
+// When Out isn't a terminal, TUIStyler prints what a DstatStyler from
+// NewBasicDstatStyler would instead.
+type TUIStyler struct {
+	Period     time.Duration // How often to redraw
+	Out        *os.File      // Where to draw, os.Stdout if nil
+	Width      int           // How many columns to use, the terminal's width if 0
+	Height     int           // How many lines to use, the terminal's height if 0
+	Thresholds []string      // Conditions values shouldn't meet, such as "Latency w99 > 50ms"
+	once       sync.Once
+	lock       sync.Mutex
+	tty        bool
+	fallback   *DstatStyler
+	thresholds []Condition
+	sets       []*tuiSet
+	lastAlert  string
+	drawn      bool
+}
+
+// A tuiSet is what TUIStyler draws for one metric set.
+type tuiSet struct {
+	msv     *metricSetValue
+	history map[string][]float64 // By column name, oldest first
+}
+
+// tuiHistory is how many intervals TUIStyler remembers, at most.
+const tuiHistory = 512
+
+func (s *TUIStyler) init() {
+	s.once.Do(func() {
+		if s.Out == nil {
+			s.Out = os.Stdout
+		}
+		s.tty = isTerminal(s.Out)
+		s.fallback = &DstatStyler{Period: s.Period, LinesBetweenHeaders: 24, Logger: log.New(s.Out, "", log.LstdFlags)}
+		for _, t := range s.Thresholds {
+			if c, err := ParseCondition(t); err == nil {
+				s.thresholds = append(s.thresholds, c)
+			}
+		}
+	})
+}
+
+// check makes sure every one of the Thresholds parses, so Start can
+// refuse a typo rather than never colouring its breaches.
+func (s *TUIStyler) check() error {
+	for _, t := range s.Thresholds {
+		if _, err := ParseCondition(t); err != nil {
+			return fmt.Errorf("olbermann: bad TUIStyler threshold %q: %v", t, err)
+		}
+	}
+	return nil
+}
+
+func (s *TUIStyler) period() time.Duration {
+	return s.Period
+}
+
+func (s *TUIStyler) linesBetweenHeaders() int {
+	s.init()
+	if !s.tty {
+		return s.fallback.linesBetweenHeaders()
+	}
+	return -1
+}
+
+func (s *TUIStyler) printHeader(msv *metricSetValue) {
+	s.init()
+	if !s.tty {
+		s.fallback.printHeader(msv)
+	}
+}
+
+func (s *TUIStyler) printValues(curTime time.Time, msv *metricSetValue) {
+	s.init()
+	if !s.tty {
+		s.fallback.printValues(curTime, msv)
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var set *tuiSet
+	for i := range s.sets {
+		if s.sets[i].msv.rtype == msv.rtype {
+			set = s.sets[i]
+		}
+	}
+	if set == nil {
+		set = &tuiSet{history: make(map[string][]float64)}
+		s.sets = append(s.sets, set)
+	}
+	set.msv = msv
+	for i := range msv.metrics {
+		mv := &msv.metrics[i]
+		for j := range mv.reports {
+			col := mv.fullName() + " " + mv.reports[j].name
+			h := append(set.history[col], mv.reports[j].value)
+			if len(h) > tuiHistory {
+				h = h[len(h)-tuiHistory:]
+			}
+			set.history[col] = h
+		}
+	}
+	s.draw()
+}
+
+func (s *TUIStyler) printAlert(ev *AlertEvent) {
+	s.init()
+	if !s.tty {
+		s.fallback.printAlert(ev)
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var msv *metricSetValue
+	for i := range s.sets {
+		if s.sets[i].msv.rtype.String() == ev.Set {
+			msv = s.sets[i].msv
+		}
+	}
+	s.lastAlert = fmt.Sprintf("%s ALERT %s: %s is %s", ev.Time.Format("15:04:05"), ev.Rule, ev.Metric, ev.value(msv))
+	s.draw()
+}
+
+func (s *TUIStyler) printFinal(report *finalReport) {
+	s.init()
+	s.lock.Lock()
+	if s.drawn {
+		io.WriteString(s.Out, ansiReset+ansiShowCursor+ansiMainScreen)
+		s.drawn = false
+	}
+	s.lock.Unlock()
+	s.fallback.printFinal(report)
+}
+
+// breached reports whether a report's value meets one of the Thresholds.
+func (s *TUIStyler) breached(mv *metricValue, rv *reportValue) bool {
+	for i := range s.thresholds {
+		c := &s.thresholds[i]
+		if c.Report != rv.name || c.Metric != mv.name && c.Metric != mv.fullName() {
+			continue
+		}
+		if held, err := c.holds(rv.value, mv.format.unit); err == nil && held {
+			return true
+		}
+	}
+	return false
+}
+
+// valueRange returns the lowest and highest of values, leaving out NaNs,
+// and whether there were any others.
+func valueRange(values []float64) (lo, hi float64, ok bool) {
+	for _, v := range values {
+		if math.IsNaN(v) {
+			continue
+		}
+		if !ok || v < lo {
+			lo = v
+		}
+		if !ok || v > hi {
+			hi = v
+		}
+		ok = true
+	}
+	return
+}
+
+// sparkline draws values, marking the lowest and highest.
+func sparkline(values []float64) string {
+	lo, hi, _ := valueRange(values)
+	var buf bytes.Buffer
+	markedLo, markedHi := false, false
+	for _, v := range values {
+		if math.IsNaN(v) {
+			buf.WriteString(" ")
+			continue
+		}
+		bar := 0
+		if hi > lo {
+			bar = int((v - lo) / (hi - lo) * float64(len(sparkBars)-1))
+		}
+		switch {
+		case v == hi && !markedHi && hi > lo:
+			markedHi = true
+			fmt.Fprintf(&buf, "%s%c%s", ansiYellow, sparkBars[bar], ansiReset)
+		case v == lo && !markedLo && hi > lo:
+			markedLo = true
+			fmt.Fprintf(&buf, "%s%c%s", ansiCyan, sparkBars[bar], ansiReset)
+		default:
+			buf.WriteRune(sparkBars[bar])
+		}
+	}
+	return buf.String()
+}
+
+// fit pads or cuts str to width columns.
+func fit(str string, width int) string {
+	n := utf8.RuneCountInString(str)
+	if width <= 0 {
+		return ""
+	}
+	if n > width {
+		return string([]rune(str)[:width-1]) + "…"
+	}
+	return str + strings.Repeat(" ", width-n)
+}
+
+// draw redraws the whole screen.
+func (s *TUIStyler) draw() {
+	width, height := s.Width, s.Height
+	if width <= 0 {
+		width = terminalWidth(s.Out)
+	}
+	if height <= 0 {
+		height = terminalHeight(s.Out)
+	}
+	nameWidth, reportWidth := 8, 0
+	for _, set := range s.sets {
+		for i := range set.msv.metrics {
+			mv := &set.msv.metrics[i]
+			if n := utf8.RuneCountInString(mv.fullName()); n > nameWidth {
+				nameWidth = n
+			}
+			for j := range mv.reports {
+				if n := utf8.RuneCountInString(mv.reports[j].name); n > reportWidth {
+					reportWidth = n
+				}
+			}
+		}
+	}
+	if nameWidth > width/3 {
+		nameWidth = width / 3
+	}
+	const valueWidth = 10
+	sparkWidth := width - nameWidth - reportWidth - 2 - 3*(valueWidth+1) - 2
+	if sparkWidth < 0 {
+		sparkWidth = 0
+	}
+
+	var lines []string
+	line := func(format string, args ...interface{}) {
+		lines = append(lines, fmt.Sprintf(format, args...))
+	}
+	for _, set := range s.sets {
+		msv := set.msv
+		line("%s%s%s  %s  elapsed %s", ansiBold, msv.rtype, ansiReset, msv.time.Format("15:04:05"), msv.cumDuration.Truncate(time.Second))
+		line("%s %-*s %*s %*s %*s  history", fit("", nameWidth), reportWidth, "", valueWidth, "now", valueWidth, "min", valueWidth, "max")
+		for i := range msv.metrics {
+			mv := &msv.metrics[i]
+			for j := range mv.reports {
+				rv := &mv.reports[j]
+				name := ""
+				if j == 0 {
+					name = mv.fullName()
+				}
+				history := set.history[mv.fullName()+" "+rv.name]
+				min, max := "", ""
+				if lo, hi, ok := valueRange(history); ok {
+					min, max = mv.format.string(rv.rt, lo), mv.format.string(rv.rt, hi)
+				}
+				if len(history) > sparkWidth {
+					history = history[len(history)-sparkWidth:]
+				}
+				now := fmt.Sprintf("%*s", valueWidth, mv.string(rv))
+				if s.breached(mv, rv) {
+					now = ansiRed + ansiBold + now + ansiReset
+				}
+				line("%s %-*s %s %*s %*s  %s", fit(name, nameWidth), reportWidth, rv.name, now,
+					valueWidth, min, valueWidth, max, sparkline(history))
+			}
+		}
+		line("")
+	}
+	// Keep the latest alert in sight, and say how much didn't fit.
+	rows := height
+	if s.lastAlert != "" {
+		rows--
+	}
+	if len(lines) > rows && rows > 0 {
+		hidden := len(lines) - rows + 1
+		lines = append(lines[:rows-1], fmt.Sprintf("… %d more lines", hidden))
+	}
+	if s.lastAlert != "" {
+		line("%s%s%s", ansiRed, s.lastAlert, ansiReset)
+	}
+	if len(lines) > height {
+		lines = lines[len(lines)-height:]
+	}
+
+	var buf bytes.Buffer
+	if !s.drawn {
+		buf.WriteString(ansiAltScreen + ansiHideCursor + ansiClear)
+		s.drawn = true
+	}
+	buf.WriteString(ansiHome)
+	// No newline after the last line, which would scroll a full screen.
+	buf.WriteString(strings.Join(lines, ansiClearLine+"\n"))
+	buf.WriteString(ansiClearLine + ansiClearBelow)
+	io.Copy(s.Out, &buf)
+}
@@ -0,0 +1,153 @@
+package olbermann
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSparkline(t *testing.T) {
+	line := sparkline([]float64{1, 2, 3, 8, 2})
+	expected := ansiCyan + "▁" + ansiReset + "▂▃" + ansiYellow + "█" + ansiReset + "▂"
+	if line != expected {
+		t.Errorf("expected %q, got %q", expected, line)
+	}
+	if line := sparkline([]float64{5, 5}); line != "▁▁" {
+		t.Errorf("expected a flat line, got %q", line)
+	}
+	if lo, hi, ok := valueRange([]float64{math.NaN(), 3, 1, math.NaN()}); !ok || lo != 1 || hi != 3 {
+		t.Errorf("expected 1 to 3 without the NaNs, got %v to %v", lo, hi)
+	}
+	if _, _, ok := valueRange([]float64{math.NaN()}); ok {
+		t.Error("expected no range without values")
+	}
+}
+
+func TestTUIStyler(t *testing.T) {
+	f, err := ioutil.TempFile("", "olbermann")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	s := &TUIStyler{Out: f, Width: 100, Thresholds: []string{"Latency w99 > 50ms"}}
+	s.init()
+	if s.tty {
+		t.Fatal("expected a file not to be a terminal")
+	}
+	s.tty = true
+	type tuiMetric struct {
+		Ops     int64   `type:"counter" report:"iter"`
+		Latency float64 `type:"latency" report:"w99" unit:"ms"`
+	}
+	r := &Reporter{}
+	tr := startTestRun(t, r, tuiMetric{}, s)
+	for i := 1; i <= 5; i++ {
+		tr.interval(tuiMetric{Ops: int64(i), Latency: float64(20 * i)})
+	}
+	r.Close()
+	if err := (&Reporter{}).Start(tuiMetric{}, &TUIStyler{Out: f, Thresholds: []string{"Latency w99 >> 50ms"}}); err == nil {
+		t.Error("expected Start to refuse a threshold that doesn't parse")
+	}
+
+	out, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	screens := strings.Split(string(out), ansiHome)
+	if len(screens) != 6 || screens[0] != ansiAltScreen+ansiHideCursor+ansiClear {
+		t.Fatalf("expected the screen cleared once and redrawn every interval, got %d screens", len(screens)-1)
+	}
+	last := screens[5]
+	if !strings.Contains(last, "Ops") || !strings.Contains(last, ansiCyan+"▁") || !strings.Contains(last, ansiYellow+"█") {
+		t.Errorf("expected sparklines with markers, got %q", last)
+	}
+	if !strings.Contains(last, ansiRed+ansiBold+"  100.00ms") {
+		t.Errorf("expected the breached latency in red, got %q", last)
+	}
+	if strings.Contains(screens[2], ansiRed) {
+		t.Errorf("expected no red before the threshold is breached, got %q", screens[2])
+	}
+	if !strings.Contains(last, ansiShowCursor+ansiMainScreen) {
+		t.Errorf("expected the terminal restored at Close, got %q", last)
+	}
+}
+
+func TestTUIStylerFits(t *testing.T) {
+	f, err := ioutil.TempFile("", "olbermann")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	s := &TUIStyler{Out: f, Width: 80, Height: 5}
+	s.init()
+	s.tty = true
+	type longMetric struct {
+		Latency float64 `type:"latency" report:"w50,w99.999,c99.999" unit:"ms"`
+	}
+	r := &Reporter{}
+	startTestRun(t, r, longMetric{}, s).interval(longMetric{Latency: 1})
+	r.Close()
+	out, _ := ioutil.ReadFile(f.Name())
+	screen := strings.Split(string(out), ansiHome)[1]
+	screen = screen[:strings.Index(screen, ansiClearBelow)]
+	lines := strings.Split(screen, ansiClearLine+"\n")
+	if len(lines) != 5 || lines[4] != "… 2 more lines"+ansiClearLine {
+		t.Fatalf("expected the screen cut to 5 lines, got %q", lines)
+	}
+	// A report name longer than most mustn't push its values out of line.
+	for _, line := range lines[2:4] {
+		if now, value := strings.Index(lines[1], "now")+len("now"), strings.Index(line, "1.00ms")+len("1.00ms"); now != value {
+			t.Errorf("expected values lined up under their heading, got\n%s\n%s", lines[1], line)
+		}
+	}
+}
+
+func TestTUIStylerFallback(t *testing.T) {
+	f, err := ioutil.TempFile("", "olbermann")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	s := &TUIStyler{Out: f}
+	r := &Reporter{}
+	startTestRun(t, r, recordedMetric{}, s).interval(recordedMetric{Op: "get", Ops: 1})
+	r.Close()
+	out, _ := ioutil.ReadFile(f.Name())
+	if strings.Contains(string(out), "\x1b[") || !strings.Contains(string(out), "ops{op=get}") {
+		t.Errorf("expected dstat output, got %q", out)
+	}
+}
+
+func TestTUIStylerNarrow(t *testing.T) {
+	f, err := ioutil.TempFile("", "olbermann")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	// Too narrow for any sparkline.
+	s := &TUIStyler{Out: f, Width: 40, Height: 10}
+	s.init()
+	s.tty = true
+	type narrowMetric struct {
+		Ops int64 `type:"counter" report:"total"`
+	}
+	r := &Reporter{}
+	tr := startTestRun(t, r, narrowMetric{}, s)
+	for i := 1; i <= 3; i++ {
+		tr.interval(narrowMetric{Ops: int64(i)})
+	}
+	r.Close()
+	out, _ := ioutil.ReadFile(f.Name())
+	screens := strings.Split(string(out), ansiHome)
+	lines := strings.Split(screens[len(screens)-1], ansiClearLine+"\n")
+	if fields := strings.Fields(lines[2]); len(fields) != 5 || fields[2] != "6" || fields[3] != "1" || fields[4] != "6" {
+		t.Errorf("expected the total now, and its lowest and highest, got %q", lines[2])
+	}
+}
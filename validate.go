@@ -0,0 +1,70 @@
+package olbermann
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// A FieldError describes a problem with one field of a metric struct.
+type FieldError struct {
+	Field string // The field's (dotted) name, or "" if the problem is with the whole struct
+	Tag   string // The tag at fault, or "" if the problem is with the field itself
+	Value string // The offending tag value
+	Msg   string // What is wrong with it
+}
+
+func (e *FieldError) Error() string {
+	if e.Field == "" {
+		return e.Msg
+	}
+	if e.Tag == "" {
+		return e.Field + ": " + e.Msg
+	}
+	return fmt.Sprintf("%s %s:%q: %s", e.Field, e.Tag, e.Value, e.Msg)
+}
+
+// A ValidationError is returned by Start and Validate for a metric struct
+// with invalid definitions, or a sample that isn't a struct, and lists
+// every problem found.
+type ValidationError struct {
+	Type   string // The metric struct's type
+	Errors []*FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i := range e.Errors {
+		msgs[i] = e.Errors[i].Error()
+	}
+	problems := "problems"
+	if len(msgs) == 1 {
+		problems = "problem"
+	}
+	return fmt.Sprintf("olbermann: %d %s with metric struct %s: %s", len(msgs), problems, e.Type, strings.Join(msgs, "; "))
+}
+
+// fieldErrors collects the problems found while building a metricSetType.
+type fieldErrors []*FieldError
+
+func (errs *fieldErrors) add(field reflect.StructField, tag string, msg string) {
+	*errs = append(*errs, &FieldError{Field: field.Name, Tag: tag, Value: field.Tag.Get(tag), Msg: msg})
+}
+
+// Validate checks the definitions in a metric struct, the same way Start
+// does, without starting anything.  It returns nil or a *ValidationError,
+// and is meant for unit tests of metric structs:
+//
+// 	func TestMetricDefinitions(t *testing.T) {
+// 		if err := olbermann.Validate(ReportableMetric{}); err != nil {
+// 			t.Error(err)
+// 		}
+// 	}
+func Validate(sample interface{}) error {
+	mst, err := newMetricSetTypeOf(sample)
+	if err != nil {
+		return err
+	}
+	mst.close()
+	return nil
+}
@@ -0,0 +1,100 @@
+package olbermann
+
+import (
+	"strings"
+	"testing"
+)
+
+type InvalidMetric struct {
+	NoReports  int     `type:"counter"`
+	Unknown    int     `type:"counter" report:"iter,bogus"`
+	Empty      int     `type:"counter" report:"iter,,total"`
+	Repeated   int     `type:"counter" report:"iter,iter"`
+	Short      float64 `type:"latency" report:"w"`
+	Blank      float64 `type:"latency" report:"c99,"`
+	Percentile float64 `type:"latency" report:"c101,x50"`
+	Gauge      int     `type:"gauge" report:"iter"`
+	Text       string  `type:"counter" report:"total"`
+	Scale      int     `type:"counter" report:"total" scale:"-1"`
+	Format     int     `type:"counter" report:"total" format:"%s"`
+	Dup        int     `type:"counter" report:"total" name:"Unknown"`
+}
+
+func TestValidate(t *testing.T) {
+	if err := Validate(SampleMetric{}); err != nil {
+		t.Error("expected SampleMetric to be valid, got", err)
+	}
+	err := Validate(&InvalidMetric{})
+	verr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatal("expected a *ValidationError, got", err)
+	}
+	expected := []string{
+		`NoReports report:"": metric must define reports`,
+		`Unknown report:"iter,bogus": unknown counter report "bogus", must be one of iter, cum, total, ewma1, ewma5, ewma15 or ewma60`,
+		`Empty report:"iter,,total": empty report name`,
+		`Repeated report:"iter,iter": duplicate report "iter"`,
+		`Short report:"w": unknown latency report "w", must be w or c followed by a percentile`,
+		`Blank report:"c99,": empty report name`,
+		`Percentile report:"c101,x50": invalid percentile in latency report "c101", must be in (0, 100]`,
+		`Percentile report:"c101,x50": unknown latency report "x50", must be w or c followed by a percentile`,
+		`Gauge type:"gauge": unknown metric type, must be counter or latency`,
+		`Text: metric has invalid kind string, must be numeric`,
+		`Scale scale:"-1": must be a positive number`,
+		`Format format:"%s": must be a single printf verb for a number, such as %.3f or %d`,
+		`Dup name:"Unknown": duplicate metric name`,
+	}
+	if len(verr.Errors) != len(expected) {
+		t.Errorf("expected %d errors, got %d: %v", len(expected), len(verr.Errors), err)
+	}
+	for i := 0; i < len(expected) && i < len(verr.Errors); i++ {
+		if s := verr.Errors[i].Error(); s != expected[i] {
+			t.Errorf("expected error %q, got %q", expected[i], s)
+		}
+	}
+	if !strings.HasPrefix(err.Error(), "olbermann: 13 problems with metric struct olbermann.InvalidMetric: NoReports") {
+		t.Error("unexpected error message", err)
+	}
+}
+
+func TestValidateLabels(t *testing.T) {
+	type badLabels struct {
+		Op     string            `label:"op"`
+		Other  string            `label:"op"`
+		Count  int               `type:"counter" report:"total" label:"x"`
+		ByName map[float64]int   `type:"counter" report:"total"`
+		Values map[string]string `type:"counter" report:"total"`
+	}
+	verr, ok := Validate(badLabels{}).(*ValidationError)
+	if !ok {
+		t.Fatal("expected a *ValidationError")
+	}
+	expected := []string{
+		`Count label:"x": only map-valued metrics may have a label`,
+		`ByName: map metric has invalid key kind float64`,
+		`Values: metric has invalid kind string, must be numeric`,
+		`Other label:"op": duplicate label name`,
+	}
+	if len(verr.Errors) != len(expected) {
+		t.Fatalf("expected %d errors, got %v", len(expected), verr)
+	}
+	for i := range expected {
+		if s := verr.Errors[i].Error(); s != expected[i] {
+			t.Errorf("expected error %q, got %q", expected[i], s)
+		}
+	}
+}
+
+func TestStartValidates(t *testing.T) {
+	r := &Reporter{C: make(chan interface{})}
+	if _, ok := r.Start(InvalidMetric{}, NewBasicDstatStyler()).(*ValidationError); !ok {
+		t.Error("expected Start to return a *ValidationError")
+	}
+	if err, ok := r.Start(nil, NewBasicDstatStyler()).(*ValidationError); !ok || err.Error() != "olbermann: 1 problem with metric struct nil: not a struct or a pointer to one" {
+		t.Error("expected Start to reject a nil sample with a *ValidationError, got", err)
+	}
+	if _, ok := Validate(42).(*ValidationError); !ok {
+		t.Error("expected Validate to reject an int with a *ValidationError")
+	}
+	r.Close()
+}